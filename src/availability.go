@@ -0,0 +1,495 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//==================================================================================== AVAILABILITY
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//the status of a car - an inactive car cant be borrowed, reserved or found (e.g. sold or in a long repair)
+//a car written before the status existed has none and is active
+const (
+	carStatusActive   = "active"
+	carStatusInactive = "inactive"
+)
+
+//the fuel types a car can have - "" is not known
+var fuelTypes = map[string]bool{"": true, "petrol": true, "diesel": true, "electric": true, "hybrid": true, "lpg": true, "cng": true, "hydrogen": true}
+
+//a car reserved for a user - ledger key "reservation1_2" for reservation 2 of car 1, the ids come from "counterR1"
+//a reservation is never deleted, a cancelled one just does not block the car anymore
+type Reservation struct {
+	Id            int    `json:"id"`
+	CarId         int    `json:"carId"`
+	UserId        int    `json:"userId"`
+	Start         string `json:"start"`
+	End           string `json:"end"`
+	Created       string `json:"created"`
+	Cancelled     bool   `json:"cancelled"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//a time a car is in the workshop - ledger key "maintenance1_2" for block 2 of car 1, the ids come from "counterM1"
+//the blocks and counters are per car, so the reservations of two cars never conflict
+type MaintenanceBlock struct {
+	Id            int    `json:"id"`
+	CarId         int    `json:"carId"`
+	Start         string `json:"start"`
+	End           string `json:"end"`
+	Reason        string `json:"reason"`
+	CreatedBy     string `json:"createdBy"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//this one is just for internal Operations in func createReservation
+type CheckReservationParameter struct {
+	CarId int    `json:"carId"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+//this one is just for internal Operations in func createMaintenanceBlock
+type CheckMaintenanceParameter struct {
+	CarId  int    `json:"carId"`
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Reason string `json:"reason"`
+}
+
+//one car of the answer of findAvailableCars - Rank 1 is the best fit
+//SpareSeats and SpareRangeKm are what the car has more than needed, 0 if nothing was required
+type AvailableCar struct {
+	Rank         int `json:"rank"`
+	Car          Car `json:"car"`
+	SpareSeats   int `json:"spareSeats"`
+	SpareRangeKm int `json:"spareRangeKm"`
+}
+
+//carBlock is a reservation or a maintenance block of a car in the times of it
+type carBlock struct {
+	Kind   string
+	Id     int
+	UserId int
+	Start  time.Time
+	End    time.Time
+}
+
+//isActive is true for a car that can be used at all
+func isActive(car Car) bool {
+	return car.Status == "" || car.Status == carStatusActive
+}
+
+//parseWindow reads a time window - start has to be before end
+func parseWindow(start string, end string) (time.Time, time.Time, []FieldError) {
+	details := []FieldError{}
+	startTime, err := time.Parse(timeFormat, start)
+	if err != nil {
+		details = append(details, fieldError("start", "has to be a time like "+timeFormat))
+	}
+	endTime, err := time.Parse(timeFormat, end)
+	if err != nil {
+		details = append(details, fieldError("end", "has to be a time like "+timeFormat))
+	}
+	if len(details) == 0 && !startTime.Before(endTime) {
+		details = append(details, fieldError("end", "has to be after start"))
+	}
+	return startTime, endTime, details
+}
+
+//ledgerNow is the time of the transaction in UTC - the same on every endorsing peer, unlike the clock of a peer
+//it has just seconds like the times written to the ledger, so it compares to the parsed ones
+//Invoke rejects a transaction without a timestamp, so there always is one
+func ledgerNow(stub shim.ChaincodeStubInterface) time.Time {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil || timestamp == nil {
+		return time.Time{}
+	}
+	return time.Unix(timestamp.Seconds, 0).UTC()
+}
+
+//readCarBlocks returns every reservation of a car that is not cancelled and every maintenance block of it
+//a transaction that writes sets prune - the ended reservations it finds are deleted, they cant block a window
+//from now on, so the range of a car just holds the reservations that are still to come
+func readCarBlocks(stub shim.ChaincodeStubInterface, carId int, prune bool) ([]carBlock, error) {
+
+	blocks := []carBlock{}
+	now := ledgerNow(stub)
+
+	reservations, err := stub.GetStateByRange(scopedRange("reservation", carId))
+	if err != nil {
+		return nil, err
+	}
+	defer reservations.Close()
+	for reservations.HasNext() {
+		it, err := reservations.Next()
+		if err != nil {
+			return nil, err
+		}
+		var reservation Reservation
+		if err := json.Unmarshal(it.Value, &reservation); err != nil {
+			return nil, errors.New("reservation " + it.Key + " is broken")
+		}
+		start, end, details := parseWindow(reservation.Start, reservation.End)
+		if len(details) != 0 {
+			return nil, errors.New("reservation " + it.Key + " is broken")
+		}
+		//cancelled ones are only left from before cancelReservation deleted them
+		if prune && (reservation.Cancelled || end.Before(now)) {
+			if err := stub.DelState(it.Key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if reservation.Cancelled {
+			continue
+		}
+		blocks = append(blocks, carBlock{Kind: "reservation", Id: reservation.Id, UserId: reservation.UserId, Start: start, End: end})
+	}
+
+	maintenances, err := stub.GetStateByRange(scopedRange("maintenance", carId))
+	if err != nil {
+		return nil, err
+	}
+	defer maintenances.Close()
+	for maintenances.HasNext() {
+		it, err := maintenances.Next()
+		if err != nil {
+			return nil, err
+		}
+		var maintenance MaintenanceBlock
+		if err := json.Unmarshal(it.Value, &maintenance); err != nil {
+			return nil, errors.New("maintenance " + it.Key + " is broken")
+		}
+		start, end, details := parseWindow(maintenance.Start, maintenance.End)
+		if len(details) != 0 {
+			return nil, errors.New("maintenance " + it.Key + " is broken")
+		}
+		blocks = append(blocks, carBlock{Kind: "maintenance", Id: maintenance.Id, Start: start, End: end})
+	}
+	return blocks, nil
+}
+
+//blockingReason returns why the car cant be used from start to end by the user or "" if it can
+//the own reservations of the user dont block him - userId 0 is nobody, then every reservation blocks
+//a borrowed car blocks every window, a borrow has no planned end
+func blockingReason(car Car, blocks []carBlock, userId int, start time.Time, end time.Time) string {
+	if !isActive(car) {
+		return "the car is " + car.Status
+	}
+	if car.BorrowId != 0 {
+		return "the car is borrowed right now (borrow " + strconv.Itoa(car.BorrowId) + ")"
+	}
+	for _, block := range blocks {
+		if !block.Start.Before(end) || !start.Before(block.End) {
+			continue
+		}
+		if block.Kind == "reservation" && block.UserId != 0 && block.UserId == userId {
+			continue
+		}
+		return "the car has the " + block.Kind + " " + strconv.Itoa(block.Id) + " from " + block.Start.Format(timeFormat) + " to " + block.End.Format(timeFormat)
+	}
+	return ""
+}
+
+//checkCarFreeNow is blockingReason for a borrow that starts now - the end of a borrow is not known, so just the moment counts
+func checkCarFreeNow(stub shim.ChaincodeStubInterface, car Car, userId int) (string, error) {
+	blocks, err := readCarBlocks(stub, car.Id, true)
+	if err != nil {
+		return "", err
+	}
+	start := ledgerNow(stub)
+	return blockingReason(car, blocks, userId, start, start.Add(time.Second)), nil
+}
+
+//scopedKeyOfArgs is the key of a record of a car for the args carId and id
+func scopedKeyOfArgs(prefix string, args []string) (string, peer.Response, bool) {
+	carId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "", Error(http.StatusBadRequest, codeInvalidParameter, "overgiven carId cant be converted to an int", fieldError("carId", "has to be an integer")), false
+	}
+	id, err := strconv.Atoi(args[1])
+	if err != nil {
+		return "", Error(http.StatusBadRequest, codeInvalidParameter, "overgiven id cant be converted to an int", fieldError(prefix+"Id", "has to be an integer")), false
+	}
+	return scopedKey(prefix, carId, id), peer.Response{}, true
+}
+
+func nextCounter(stub shim.ChaincodeStubInterface, key string) (int, error) {
+	obj, err := stub.GetState(key)
+	if err != nil {
+		return 0, err
+	}
+	counter, _ := strconv.Atoi(string(obj))
+	counter += 1
+	return counter, stub.PutState(key, []byte(strconv.Itoa(counter)))
+}
+
+//=====================================FIND AVAILABLE CARS====================================
+func (cc *CRUD) findAvailableCars(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(query) -> args[0]: "start", args[1]: "end" - e.g. "2024-05-02 08:00:00"
+	//(query) -> args[2]: "seats", args[3]: "fuelType", args[4]: "rangeKm" - "" is no requirement
+	//the best fit comes first: the least spare seats, then the least spare range, then the least km
+
+	start, end, details := parseWindow(args[0], args[1])
+	seats, seatsDetails := parseOptionalInt("seats", args[2])
+	rangeKm, rangeDetails := parseOptionalInt("rangeKm", args[4])
+	details = append(append(details, seatsDetails...), rangeDetails...)
+	if !fuelTypes[args[3]] {
+		details = append(details, fieldError("fuelType", "is no known fuel type"))
+	}
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
+	}
+	if end.Before(ledgerNow(stub)) {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "the window is over already", fieldError("end", "is in the past"))
+	}
+
+	//the caller can see if one of the cars is reserved for himself
+	userId, _ := callerUserId(stub)
+
+	resultsIterator, err := stub.GetStateByRange("car", "caw")
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	availableCars := []AvailableCar{}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		var car Car
+		if err := json.Unmarshal(it.Value, &car); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, "car "+it.Key+" is broken")
+		}
+
+		if seats != nil && car.Seats < *seats {
+			continue
+		}
+		if rangeKm != nil && car.RangeKm < *rangeKm {
+			continue
+		}
+		if args[3] != "" && car.FuelType != args[3] {
+			continue
+		}
+		//the blocks are only read for the cars that fit
+		blocks, err := readCarBlocks(stub, car.Id, false)
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		if blockingReason(car, blocks, userId, start, end) != "" {
+			continue
+		}
+
+		availableCar := AvailableCar{Car: car}
+		if seats != nil {
+			availableCar.SpareSeats = car.Seats - *seats
+		}
+		if rangeKm != nil {
+			availableCar.SpareRangeKm = car.RangeKm - *rangeKm
+		}
+		availableCars = append(availableCars, availableCar)
+	}
+
+	sort.SliceStable(availableCars, func(i, j int) bool {
+		a, b := availableCars[i], availableCars[j]
+		if a.SpareSeats != b.SpareSeats {
+			return a.SpareSeats < b.SpareSeats
+		}
+		if a.SpareRangeKm != b.SpareRangeKm {
+			return a.SpareRangeKm < b.SpareRangeKm
+		}
+		if a.Car.Km != b.Car.Km {
+			return a.Car.Km < b.Car.Km
+		}
+		return a.Car.Id < b.Car.Id
+	})
+	for i := range availableCars {
+		availableCars[i].Rank = i + 1
+	}
+
+	availableCarsAsBytes, _ := json.Marshal(availableCars)
+	return Success(http.StatusOK, "OK", availableCarsAsBytes)
+}
+
+//=====================================CREATE RESERVATION=====================================
+func (cc *CRUD) createReservation(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "userId"
+	//(body) -> args[1]: {"carId":1,"start":"2024-05-02 08:00:00","end":"2024-05-02 17:00:00"}
+
+	var overgivenParam CheckReservationParameter
+	if response, ok := decodeBody("reservation", args[1], &overgivenParam); !ok {
+		return response
+	}
+	start, end, details := parseWindow(overgivenParam.Start, overgivenParam.End)
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
+	}
+	if start.Before(ledgerNow(stub)) {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "a reservation cant start in the past", fieldError("start", "is in the past"))
+	}
+
+	ledgerUser, err := stub.GetState("user" + args[0])
+	if err != nil || ledgerUser == nil {
+		return Error(http.StatusNotFound, codeUserNotFound, "User Not Found")
+	}
+	var user User
+	json.Unmarshal(ledgerUser, &user)
+	if user.Erased {
+		return Error(http.StatusGone, codeUserErased, "the user was erased")
+	}
+
+	ledgerCar, err := stub.GetState("car" + strconv.Itoa(overgivenParam.CarId))
+	if err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found - wrong overgiven carId!")
+	}
+	var car Car
+	json.Unmarshal(ledgerCar, &car)
+
+	//the licence has to be valid when the trip starts, the pool is checked like for a borrow
+	if msg := checkLicence(user, car, start); msg != "" {
+		return Error(http.StatusForbidden, codeLicenceInvalid, msg)
+	}
+	if !isEntitled(user, car) {
+		return Error(http.StatusForbidden, codeNotEntitled, "the user is not entitled to the pool of this car")
+	}
+
+	//a car borrowed right now can still be reserved for later, the borrow is checked when the reservation starts
+	blocks, err := readCarBlocks(stub, car.Id, true)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	car.BorrowId = 0
+	if reason := blockingReason(car, blocks, 0, start, end); reason != "" {
+		return Error(http.StatusConflict, codeCarNotAvailable, reason)
+	}
+
+	counter, err := nextCounter(stub, "counterR"+strconv.Itoa(car.Id))
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	reservation := Reservation{
+		Id:      counter,
+		CarId:   car.Id,
+		UserId:  user.Id,
+		Start:   overgivenParam.Start,
+		End:     overgivenParam.End,
+		Created: ledgerNow(stub).Format(timeFormat),
+	}
+	reservationAsBytes, _ := json.Marshal(reservation)
+	if err := stub.PutState(scopedKey("reservation", car.Id, counter), reservationAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Car reserved", reservationAsBytes)
+	return Success(http.StatusCreated, "Created", reservationAsBytes)
+}
+
+//=====================================CANCEL RESERVATION=====================================
+func (cc *CRUD) cancelReservation(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId", args[1]: "reservationId"
+	key, response, ok := scopedKeyOfArgs("reservation", args)
+	if !ok {
+		return response
+	}
+
+	ledgerReservation, err := stub.GetState(key)
+	if err != nil || ledgerReservation == nil {
+		return Error(http.StatusNotFound, codeReservationNotFound, "Reservation Not Found")
+	}
+	var reservation Reservation
+	json.Unmarshal(ledgerReservation, &reservation)
+	if !isAdmin(stub) {
+		if callerId, err := callerUserId(stub); err != nil || callerId != reservation.UserId {
+			return Error(http.StatusForbidden, codeAdminRequired, "only an admin or the user of the reservation can cancel it")
+		}
+	}
+	if reservation.Cancelled {
+		return Error(http.StatusConflict, codeReservationCancelled, "the reservation is cancelled already")
+	}
+
+	//a cancelled reservation is deleted, the event keeps it
+	reservation.Cancelled = true
+	reservationAsBytes, _ := json.Marshal(reservation)
+	if err := stub.DelState(key); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Reservation cancelled", reservationAsBytes)
+	return Success(http.StatusOK, "OK", reservationAsBytes)
+}
+
+//=====================================CREATE MAINTENANCE BLOCK===============================
+func (cc *CRUD) createMaintenanceBlock(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(body) -> args[0]: {"carId":1,"start":"2024-05-06 07:00:00","end":"2024-05-07 18:00:00","reason":"inspection"}
+	//the workshop does not wait for reservations - the users of the reservations in the block have to be told
+
+	var overgivenParam CheckMaintenanceParameter
+	if response, ok := decodeBody("maintenance", args[0], &overgivenParam); !ok {
+		return response
+	}
+	_, _, details := parseWindow(overgivenParam.Start, overgivenParam.End)
+	if overgivenParam.Reason == "" {
+		details = append(details, fieldError("reason", "cant be empty"))
+	}
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
+	}
+	if ledgerCar, err := stub.GetState("car" + strconv.Itoa(overgivenParam.CarId)); err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found - wrong overgiven carId!")
+	}
+
+	counter, err := nextCounter(stub, "counterM"+strconv.Itoa(overgivenParam.CarId))
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	maintenance := MaintenanceBlock{
+		Id:        counter,
+		CarId:     overgivenParam.CarId,
+		Start:     overgivenParam.Start,
+		End:       overgivenParam.End,
+		Reason:    overgivenParam.Reason,
+		CreatedBy: callerId(stub),
+	}
+	maintenanceAsBytes, _ := json.Marshal(maintenance)
+	if err := stub.PutState(scopedKey("maintenance", overgivenParam.CarId, counter), maintenanceAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Maintenance planned", maintenanceAsBytes)
+	return Success(http.StatusCreated, "Created", maintenanceAsBytes)
+}
+
+//=====================================DELETE MAINTENANCE BLOCK===============================
+func (cc *CRUD) deleteMaintenanceBlock(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId", args[1]: "maintenanceId"
+	key, response, ok := scopedKeyOfArgs("maintenance", args)
+	if !ok {
+		return response
+	}
+
+	if ledgerMaintenance, err := stub.GetState(key); err != nil || ledgerMaintenance == nil {
+		return Error(http.StatusNotFound, codeMaintenanceNotFound, "Maintenance Block Not Found")
+	}
+	if err := stub.DelState(key); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Maintenance deleted", []byte("maintenance: "+key))
+	return Success(http.StatusOK, "OK", []byte("Maintenance block deleted"))
+}
@@ -0,0 +1,428 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//===================================================================================== BULK IMPORT
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//one transaction cant get too big, a site with more cars has to be imported in more than one go
+const bulkMaxRows = 500
+
+//the key of the transient map with the personal data of bulkCreateUsers
+//[{"id":4,"name":"Alice","salt":"8c1f0e4b2a7d93e6"}]
+const transientUsersPII = "users"
+
+//one invalid row of a bulk import - Row starts with 1 and does not count the CSV header, Row 0 is an error of the header
+type BulkRowError struct {
+	Row   int    `json:"row"`
+	Id    int    `json:"id"`
+	Error string `json:"error"`
+}
+
+//the answer of a bulk import - either everything is Created or nothing and Errors says why
+type BulkResult struct {
+	Created int            `json:"created"`
+	Errors  []BulkRowError `json:"errors"`
+}
+
+//this one is just for internal Operations in func bulkCreateUsers - one entry of the transient key "users"
+type CheckBulkUserPIIParameter struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Salt string `json:"salt"`
+}
+
+//isJSONArray decides if the overgiven data is JSON or CSV
+func isJSONArray(data string) bool {
+	return strings.HasPrefix(strings.TrimSpace(data), "[")
+}
+
+//the columns a CSV of bulkCreateCars and bulkCreateUsers can have - the json names of the fields
+var (
+	bulkCarColumns  = []string{"id", "km", "category", "siteId", "lat", "long", "seats", "fuelType", "rangeKm", "status"}
+	bulkUserColumns = []string{"id"}
+)
+
+//readCSV returns the rows of a CSV text as maps of header -> value
+//the header names are the json names of the fields, e.g. "id,km,category,siteId,lat,long,seats,fuelType,rangeKm"
+//a row with the wrong number of columns is reported and stays empty
+//an unknown or repeated header name is reported as row 0, so a typo cant leave a column empty without a word
+func readCSV(data string, columns []string) ([]map[string]string, []BulkRowError, error) {
+
+	reader := csv.NewReader(strings.NewReader(strings.TrimSpace(data)))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, errors.New("the CSV cant be read: " + err.Error())
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("the CSV has no header")
+	}
+
+	header := records[0]
+	rows := []map[string]string{}
+	rowErrors := []BulkRowError{}
+
+	known := map[string]bool{}
+	for _, column := range columns {
+		known[column] = true
+	}
+	seen := map[string]bool{}
+	for _, name := range header {
+		name = strings.TrimSpace(name)
+		switch {
+		case !known[name]:
+			rowErrors = append(rowErrors, BulkRowError{Row: 0, Error: "the column " + name + " is unknown - the columns are " + strings.Join(columns, ",")})
+		case seen[name]:
+			rowErrors = append(rowErrors, BulkRowError{Row: 0, Error: "the column " + name + " is there twice"})
+		}
+		seen[name] = true
+	}
+	for i, record := range records[1:] {
+		row := map[string]string{}
+		if len(record) != len(header) {
+			rowErrors = append(rowErrors, BulkRowError{Row: i + 1, Error: "the row has " + strconv.Itoa(len(record)) + " columns, the header " + strconv.Itoa(len(header))})
+			rows = append(rows, row)
+			continue
+		}
+		for j, name := range header {
+			row[strings.TrimSpace(name)] = strings.TrimSpace(record[j])
+		}
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
+
+//csvInt is 0 for an empty or missing column
+func csvInt(row map[string]string, name string) (int, error) {
+	if row[name] == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(row[name])
+	if err != nil {
+		return 0, errors.New(name + " is not an int")
+	}
+	return value, nil
+}
+
+func csvFloat(row map[string]string, name string) (float64, error) {
+	if row[name] == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseFloat(row[name], 64)
+	if err != nil {
+		return 0, errors.New(name + " is not a number")
+	}
+	return value, nil
+}
+
+//invalidRows are the rows that already have an error and are not checked any further
+func invalidRows(rowErrors []BulkRowError) map[int]bool {
+	invalid := map[int]bool{}
+	for _, rowError := range rowErrors {
+		invalid[rowError.Row] = true
+	}
+	return invalid
+}
+
+//parseBulkCars reads the cars of JSON or CSV - a row that cant be read is reported and left out
+func parseBulkCars(data string) ([]Car, []BulkRowError, error) {
+
+	cars := []Car{}
+	rowErrors := []BulkRowError{}
+
+	if isJSONArray(data) {
+		var rows []json.RawMessage
+		if err := json.Unmarshal([]byte(unescapeBody(data)), &rows); err != nil {
+			return nil, nil, errors.New("Unmarshalling the overgiven Data failed")
+		}
+		for i, row := range rows {
+			var car Car
+			if _, details := decodeBodyFields("row", string(row), documentFields(&car)); len(details) != 0 {
+				rowErrors = append(rowErrors, BulkRowError{Row: i + 1, Error: fieldErrorsText(details)})
+				car = Car{}
+			}
+			cars = append(cars, car)
+		}
+		return cars, rowErrors, nil
+	}
+
+	rows, rowErrors, err := readCSV(data, bulkCarColumns)
+	if err != nil {
+		return nil, nil, err
+	}
+	invalid := invalidRows(rowErrors)
+	for i, row := range rows {
+		var car Car
+		if invalid[i+1] {
+			cars = append(cars, car)
+			continue
+		}
+		var errs []string
+		var err error
+		if car.Id, err = csvInt(row, "id"); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if car.Km, err = csvInt(row, "km"); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if car.Location.SiteId, err = csvInt(row, "siteId"); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if car.Location.Lat, err = csvFloat(row, "lat"); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if car.Location.Long, err = csvFloat(row, "long"); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if car.Seats, err = csvInt(row, "seats"); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if car.RangeKm, err = csvInt(row, "rangeKm"); err != nil {
+			errs = append(errs, err.Error())
+		}
+		car.Category = row["category"]
+		car.FuelType = row["fuelType"]
+		car.Status = row["status"]
+		if len(errs) != 0 {
+			rowErrors = append(rowErrors, BulkRowError{Row: i + 1, Id: car.Id, Error: strings.Join(errs, ", ")})
+		}
+		cars = append(cars, car)
+	}
+	return cars, rowErrors, nil
+}
+
+//parseBulkUsers reads the users of JSON or CSV (just the column "id" - the names are in the transient map)
+func parseBulkUsers(data string) ([]User, []BulkRowError, error) {
+
+	users := []User{}
+	rowErrors := []BulkRowError{}
+
+	if isJSONArray(data) {
+		var rows []json.RawMessage
+		if err := json.Unmarshal([]byte(unescapeBody(data)), &rows); err != nil {
+			return nil, nil, errors.New("Unmarshalling the overgiven Data failed")
+		}
+		for i, row := range rows {
+			var user User
+			if hasNameField(row) {
+				rowErrors = append(rowErrors, BulkRowError{Row: i + 1, Error: "the name has to be overgiven in the transient map"})
+			} else if _, details := decodeBodyFields("row", string(row), documentFields(&user)); len(details) != 0 {
+				rowErrors = append(rowErrors, BulkRowError{Row: i + 1, Error: fieldErrorsText(details)})
+				user = User{}
+			}
+			users = append(users, user)
+		}
+		return users, rowErrors, nil
+	}
+
+	//a column "name" is rejected as unknown - the names have to be overgiven in the transient map
+	rows, rowErrors, err := readCSV(data, bulkUserColumns)
+	if err != nil {
+		return nil, nil, err
+	}
+	invalid := invalidRows(rowErrors)
+	for i, row := range rows {
+		var user User
+		if invalid[i+1] {
+			users = append(users, user)
+			continue
+		}
+		if user.Id, err = csvInt(row, "id"); err != nil {
+			rowErrors = append(rowErrors, BulkRowError{Row: i + 1, Error: err.Error()})
+		}
+		users = append(users, user)
+	}
+	return users, rowErrors, nil
+}
+
+//bulkResponse is 201 with the number of created rows or 400 with every row error - nothing is written then
+func bulkResponse(created int, rowErrors []BulkRowError) peer.Response {
+
+	if len(rowErrors) == 0 {
+		resultAsBytes, _ := json.Marshal(BulkResult{Created: created, Errors: rowErrors})
+		return Success(http.StatusCreated, "Created", resultAsBytes)
+	}
+
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+	resultAsBytes, _ := json.Marshal(BulkResult{Created: 0, Errors: rowErrors})
+	return ErrorWithData(http.StatusBadRequest, codeInvalidRows, strconv.Itoa(len(rowErrors))+" rows are invalid - nothing was created", resultAsBytes)
+}
+
+//=====================================BULK CREATE CARS=======================================
+func (cc *CRUD) bulkCreateCars(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(body) -> args[0]: [{"id":7,"km":7777,"category":"B","location":{"siteId":1}}]
+	//               or "id,km,category,siteId,lat,long\n7,7777,B,1,,"
+
+	cars, rowErrors, err := parseBulkCars(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, err.Error())
+	}
+	if len(cars) == 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "there is no car to import")
+	}
+	if len(cars) > bulkMaxRows {
+		return Error(http.StatusRequestEntityTooLarge, codeTooLarge, "not more than "+strconv.Itoa(bulkMaxRows)+" rows at once")
+	}
+
+	//the same checks as createCar - every row is checked, so the client gets all errors at once
+	invalid := invalidRows(rowErrors)
+	seen := map[int]int{}
+	for i := range cars {
+		row := i + 1
+		if invalid[row] {
+			continue
+		}
+		car := &cars[i]
+
+		if details := checkCarFields(*car); len(details) != 0 {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: car.Id, Error: fieldErrorsText(details)})
+			continue
+		}
+		if firstRow, found := seen[car.Id]; found {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: car.Id, Error: "the id is already in row " + strconv.Itoa(firstRow)})
+			continue
+		}
+		seen[car.Id] = row
+
+		if obj, err := stub.GetState("car" + strconv.Itoa(car.Id)); err != nil || obj != nil {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: car.Id, Error: "a car with this id already exists"})
+			continue
+		}
+
+		location, err := resolveLocation(stub, car.Location)
+		if err != nil {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: car.Id, Error: err.Error()})
+			continue
+		}
+		car.Location = location
+		car.PoolId = 0
+	}
+
+	if len(rowErrors) != 0 {
+		return bulkResponse(0, rowErrors)
+	}
+
+	//the cars belong to the org of the caller, like the ones of createCar
+	ownerOrg, err := callerTenant(stub)
+	if err != nil {
+		return Error(http.StatusForbidden, codeCallerUnknown, err.Error())
+	}
+	for _, car := range cars {
+		car.OwnerOrg = ownerOrg
+		carAsBytes, _ := json.Marshal(car)
+		if err := stub.PutState("car"+strconv.Itoa(car.Id), carAsBytes); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		if err := setOwnerPolicy(stub, "car"+strconv.Itoa(car.Id), ownerOrg); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+	}
+
+	stub.SetEvent("Cars created", []byte(strconv.Itoa(len(cars))+" cars"))
+	return bulkResponse(len(cars), rowErrors)
+}
+
+//=====================================BULK CREATE USERS======================================
+func (cc *CRUD) bulkCreateUsers(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(body) -> args[0]: [{"id":4,"borrowId":0}] or "id\n4\n5"
+	//(transient) -> "users": [{"id":4,"name":"Alice","salt":"8c1f0e4b2a7d93e6"}]
+
+	users, rowErrors, err := parseBulkUsers(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, err.Error())
+	}
+	if len(users) == 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "there is no user to import")
+	}
+	if len(users) > bulkMaxRows {
+		return Error(http.StatusRequestEntityTooLarge, codeTooLarge, "not more than "+strconv.Itoa(bulkMaxRows)+" rows at once")
+	}
+
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	var overgivenPII []CheckBulkUserPIIParameter
+	if err := json.Unmarshal(transient[transientUsersPII], &overgivenPII); err != nil {
+		return Error(http.StatusBadRequest, codeInvalidPersonalData, "the transient map needs the key users with the names and salts of the users")
+	}
+	piiOfUser := map[int]CheckBulkUserPIIParameter{}
+	for _, pii := range overgivenPII {
+		piiOfUser[pii.Id] = pii
+	}
+
+	//the same checks as createUser
+	invalid := invalidRows(rowErrors)
+	seen := map[int]int{}
+	for i := range users {
+		row := i + 1
+		if invalid[row] {
+			continue
+		}
+		user := &users[i]
+
+		if user.Id <= 0 || user.BorrowId != 0 {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: user.Id, Error: "id has to be greater than 0 and borrowId has to be 0"})
+			continue
+		}
+		if firstRow, found := seen[user.Id]; found {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: user.Id, Error: "the id is already in row " + strconv.Itoa(firstRow)})
+			continue
+		}
+		seen[user.Id] = row
+
+		if obj, err := stub.GetState("user" + strconv.Itoa(user.Id)); err != nil || obj != nil {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: user.Id, Error: "this user already exists"})
+			continue
+		}
+
+		pii, found := piiOfUser[user.Id]
+		if !found || pii.Name == "" {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: user.Id, Error: "the transient map has no name for this user"})
+			continue
+		}
+		if len(pii.Salt) < minSaltLength {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: user.Id, Error: "the salt has to be at least " + strconv.Itoa(minSaltLength) + " characters long"})
+			continue
+		}
+
+		//a new user has no licence and no pools until an admin gives them to him
+		*user = User{Id: user.Id}
+	}
+
+	if len(rowErrors) != 0 {
+		return bulkResponse(0, rowErrors)
+	}
+
+	for i := range users {
+		pii := piiOfUser[users[i].Id]
+		if err := putUserPII(stub, &users[i], UserPII{Name: pii.Name, Salt: pii.Salt}); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		userAsBytes, _ := json.Marshal(users[i])
+		if err := stub.PutState("user"+strconv.Itoa(users[i].Id), userAsBytes); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+	}
+
+	stub.SetEvent("Users created", []byte(strconv.Itoa(len(users))+" users"))
+	return bulkResponse(len(users), rowErrors)
+}
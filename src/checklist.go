@@ -0,0 +1,235 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//======================================================================================= CHECKLIST
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//what the driver answers for an item - a check is ok or not, a level is a percent (e.g. the fuel or the charge)
+const (
+	checklistItemCheck = "check"
+	checklistItemLevel = "level"
+)
+
+//the checklist of a car without a category - it is not tied to the licence classes
+const defaultChecklistCategory = "B"
+
+//one item of a checklist - Id is what the answer points to
+type ChecklistItem struct {
+	Id        string `json:"id"`
+	Label     string `json:"label"`
+	Type      string `json:"type"`
+	Mandatory bool   `json:"mandatory"`
+}
+
+//the checklist of the cars of a category (Car.Category, a car without one is "B") - ledger key "checklistB"
+type ChecklistTemplate struct {
+	Category      string          `json:"category"`
+	Items         []ChecklistItem `json:"items"`
+	Updated       string          `json:"updated"`
+	UpdatedBy     string          `json:"updatedBy"`
+	SchemaVersion int             `json:"schemaVersion"`
+}
+
+//the answer of the driver for one item - Ok for a check, Value (0 to 100) for a level
+//they are pointers, so an answer without them is not taken as ok:false or value:0
+type ChecklistAnswer struct {
+	Item  string `json:"item"`
+	Ok    *bool  `json:"ok,omitempty"`
+	Value *int   `json:"value,omitempty"`
+	Note  string `json:"note"`
+}
+
+//this one is just for internal Operations in func setChecklistTemplate
+type CheckChecklistTemplateParameter struct {
+	Items []ChecklistItem `json:"items"`
+}
+
+//a category without its own template gets these items - none is mandatory, so a borrow without a checklist still works
+var defaultChecklistItems = []ChecklistItem{
+	{Id: "fuelLevel", Label: "fuel level (or charge) in percent", Type: checklistItemLevel},
+	{Id: "cleanliness", Label: "the car is clean", Type: checklistItemCheck},
+	{Id: "warningLights", Label: "no warning light is on", Type: checklistItemCheck},
+	{Id: "warningTriangle", Label: "the warning triangle is on board", Type: checklistItemCheck},
+	{Id: "firstAidKit", Label: "the first-aid kit is on board", Type: checklistItemCheck},
+}
+
+//checklistCategory is the category of the template of a car
+func checklistCategory(category string) string {
+	category = strings.ToUpper(strings.TrimSpace(category))
+	if category == "" {
+		return defaultChecklistCategory
+	}
+	return category
+}
+
+//readChecklistTemplate is the template of a category or the default one
+func readChecklistTemplate(stub shim.ChaincodeStubInterface, category string) (ChecklistTemplate, error) {
+
+	template := ChecklistTemplate{Category: checklistCategory(category), Items: defaultChecklistItems}
+	ledgerTemplate, err := stub.GetState("checklist" + template.Category)
+	if err != nil {
+		return template, err
+	}
+	if ledgerTemplate != nil {
+		err = json.Unmarshal(ledgerTemplate, &template)
+	}
+	return template, err
+}
+
+//hasMandatoryItems is true if a borrow or return without a checklist is rejected
+func hasMandatoryItems(template ChecklistTemplate) bool {
+	for _, item := range template.Items {
+		if item.Mandatory {
+			return true
+		}
+	}
+	return false
+}
+
+//checkChecklist checks the answers of a driver against the template and returns them in the order of the template
+//field is the name of the checklist in the body, e.g. "checklist"
+func checkChecklist(template ChecklistTemplate, field string, answers []ChecklistAnswer) ([]ChecklistAnswer, string, []FieldError) {
+
+	items := map[string]ChecklistItem{}
+	for _, item := range template.Items {
+		items[item.Id] = item
+	}
+
+	details := []FieldError{}
+	answered := map[string]ChecklistAnswer{}
+	for i, answer := range answers {
+		name := field + "[" + strconv.Itoa(i) + "]"
+		item, known := items[answer.Item]
+		switch {
+		case !known:
+			details = append(details, fieldError(name+".item", "is not on the checklist of category "+template.Category))
+		case containsAnswer(answers[:i], answer.Item):
+			details = append(details, fieldError(name+".item", "is answered twice"))
+		case item.Type == checklistItemCheck && answer.Ok == nil:
+			details = append(details, fieldError(name+".ok", "is needed for a check"))
+		case item.Type == checklistItemLevel && answer.Value == nil:
+			details = append(details, fieldError(name+".value", "is needed for a level"))
+		case item.Type == checklistItemLevel && (*answer.Value < 0 || *answer.Value > 100):
+			details = append(details, fieldError(name+".value", "has to be between 0 and 100"))
+		default:
+			answered[answer.Item] = answer
+		}
+	}
+	if len(details) != 0 {
+		return nil, codeInvalidParameter, details
+	}
+
+	checked := []ChecklistAnswer{}
+	for _, item := range template.Items {
+		answer, ok := answered[item.Id]
+		if ok {
+			checked = append(checked, answer)
+		} else if item.Mandatory {
+			details = append(details, fieldError(field, "misses the mandatory item "+item.Id))
+		}
+	}
+	if len(details) != 0 {
+		return nil, codeChecklistIncomplete, details
+	}
+	return checked, "", nil
+}
+
+//failedChecks are the mandatory checks the driver answered with ok:false - the answers have to be checked by checkChecklist
+//a borrow with one of them is rejected, a return is not stopped but its travelLog gets them
+func failedChecks(template ChecklistTemplate, answers []ChecklistAnswer) []string {
+
+	failed := []string{}
+	for _, item := range template.Items {
+		if !item.Mandatory || item.Type != checklistItemCheck {
+			continue
+		}
+		for _, answer := range answers {
+			if answer.Item == item.Id && !*answer.Ok {
+				failed = append(failed, item.Id)
+			}
+		}
+	}
+	return failed
+}
+
+//containsAnswer is true if one of the answers is for the item
+func containsAnswer(answers []ChecklistAnswer, item string) bool {
+	for _, answer := range answers {
+		if answer.Item == item {
+			return true
+		}
+	}
+	return false
+}
+
+//=====================================SET CHECKLIST TEMPLATE=================================
+func (cc *CRUD) setChecklistTemplate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "category" - like Car.Category, e.g. "B"
+	//(body) -> args[1]: {"items":[{"id":"fuelLevel","label":"fuel level in percent","type":"level","mandatory":true}]}
+
+	var overgivenParam CheckChecklistTemplateParameter
+	if response, ok := decodeBody("checklist", args[1], &overgivenParam); !ok {
+		return response
+	}
+	if len(overgivenParam.Items) == 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "a checklist needs at least one item", fieldError("items", "cant be empty"))
+	}
+
+	details := []FieldError{}
+	ids := map[string]bool{}
+	for i, item := range overgivenParam.Items {
+		name := "items[" + strconv.Itoa(i) + "]"
+		if strings.TrimSpace(item.Id) == "" {
+			details = append(details, fieldError(name+".id", "cant be empty"))
+		} else if ids[item.Id] {
+			details = append(details, fieldError(name+".id", "is there twice"))
+		}
+		ids[item.Id] = true
+		if item.Type != checklistItemCheck && item.Type != checklistItemLevel {
+			details = append(details, fieldError(name+".type", "has to be check or level"))
+		}
+	}
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, details[0].Field+" "+details[0].Message, details...)
+	}
+
+	template := ChecklistTemplate{
+		Category:  checklistCategory(args[0]),
+		Items:     overgivenParam.Items,
+		Updated:   ledgerNow(stub).Format(timeFormat),
+		UpdatedBy: callerId(stub),
+	}
+	templateAsBytes, _ := json.Marshal(template)
+	if err := stub.PutState("checklist"+template.Category, templateAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Checklist changed", templateAsBytes)
+	return Success(http.StatusOK, "OK", templateAsBytes)
+}
+
+//=====================================GET CHECKLIST TEMPLATE=================================
+func (cc *CRUD) getChecklistTemplate(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "category" - a category without its own checklist gets the default one
+
+	template, err := readChecklistTemplate(stub, args[0])
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	templateAsBytes, _ := json.Marshal(template)
+	return Success(http.StatusOK, "OK", templateAsBytes)
+}
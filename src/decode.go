@@ -0,0 +1,154 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//========================================================================================== DECODE
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//a body is never bigger than this - the bulk functions and importLedger have their own limit in the registry
+const maxBodySize = 64 * 1024
+const maxBulkBodySize = 4 * 1024 * 1024
+
+//the message of a field that is no JSON - the registry answers with codeInvalidJSON then
+const msgNoJSON = "is no valid JSON"
+
+//unescapeBody makes JSON out of a body the REST layer escaped
+//a body like {\"id\":7} is the content of a JSON string and "{\"id\":7}" is a JSON string - both are {"id":7}
+//a body that is JSON already is not changed, so a backslash in a value stays where it is
+func unescapeBody(body string) string {
+	trimmed := strings.TrimSpace(body)
+	if json.Valid([]byte(trimmed)) {
+		if strings.HasPrefix(trimmed, "\"") {
+			var content string
+			if err := json.Unmarshal([]byte(trimmed), &content); err == nil && json.Valid([]byte(content)) {
+				return content
+			}
+		}
+		return body
+	}
+
+	var content string
+	if err := json.Unmarshal([]byte("\""+trimmed+"\""), &content); err == nil && json.Valid([]byte(content)) {
+		return content
+	}
+	return body
+}
+
+//checkBodySize is the field error of a body that is bigger than limit
+func checkBodySize(name string, body string, limit int) []FieldError {
+	if len(body) > limit {
+		return []FieldError{fieldError(name, "has "+strconv.Itoa(len(body))+" bytes, only "+strconv.Itoa(limit)+" are allowed")}
+	}
+	return nil
+}
+
+//decodeStrict fails on fields the struct does not have and on anything after the JSON value
+//a type with its own UnmarshalJSON has to be decoded with its xFields type (see schema.go), else the check is lost
+func decodeStrict(data []byte, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("there is more data after the JSON value")
+	}
+	return nil
+}
+
+//decodeErrorFields turns an error of decodeStrict into the field that is wrong
+//name is the field of a body that is no JSON at all
+func decodeErrorFields(name string, err error) (string, []FieldError) {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxError):
+		return codeInvalidJSON, []FieldError{fieldError(name, msgNoJSON+" at byte "+strconv.FormatInt(syntaxError.Offset, 10))}
+	case errors.As(err, &typeError):
+		field := typeError.Field
+		if field == "" {
+			field = name
+		}
+		return codeInvalidParameter, []FieldError{fieldError(field, "has to be "+jsonTypeName(typeError.Type)+", not "+typeError.Value)}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, unquoteErr := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		if unquoteErr != nil {
+			field = strings.TrimPrefix(err.Error(), "json: unknown field ")
+		}
+		return codeInvalidParameter, []FieldError{fieldError(field, "is unknown")}
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return codeInvalidJSON, []FieldError{fieldError(name, msgNoJSON)}
+	}
+	return codeInvalidJSON, []FieldError{fieldError(name, err.Error())}
+}
+
+//jsonTypeName is the name of the JSON type a go type is decoded from
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+//decodeBodyFields decodes a body strictly into value and returns the wrong fields
+//value has to point to a struct or a slice and the body has to be an object or an array then - null is neither
+func decodeBodyFields(name string, body string, value interface{}) (string, []FieldError) {
+	data := []byte(strings.TrimSpace(unescapeBody(body)))
+
+	kind := reflect.TypeOf(value).Elem().Kind()
+	if kind == reflect.Struct && !bytes.HasPrefix(data, []byte("{")) && json.Valid(data) {
+		return codeInvalidParameter, []FieldError{fieldError(name, "has to be a JSON object")}
+	}
+	if kind == reflect.Slice && !bytes.HasPrefix(data, []byte("[")) && json.Valid(data) {
+		return codeInvalidParameter, []FieldError{fieldError(name, "has to be a JSON array")}
+	}
+
+	if err := decodeStrict(data, value); err != nil {
+		return decodeErrorFields(name, err)
+	}
+	return "", nil
+}
+
+//decodeBody is decodeBodyFields for a handler - the answer is the 400 of the first wrong field
+func decodeBody(name string, body string, value interface{}) (peer.Response, bool) {
+	code, details := decodeBodyFields(name, body, value)
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, code, details[0].Field+" "+details[0].Message, details...), false
+	}
+	return peer.Response{}, true
+}
+
+//fieldErrorsText is the text of field errors for a row of a bulk import
+func fieldErrorsText(details []FieldError) string {
+	texts := []string{}
+	for _, detail := range details {
+		texts = append(texts, detail.Field+" "+detail.Message)
+	}
+	return strings.Join(texts, ", ")
+}
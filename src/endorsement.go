@@ -0,0 +1,103 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//===================================================================================== ENDORSEMENT
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//a car belongs to the org (MSP ID) in OwnerOrg - a peer of this org has to endorse every write of the car and of its borrows
+//the policy is set on the key of the car when it is created and on the key of a borrow when it starts
+//a car from before has no OwnerOrg and no policy of its own, the policy of the chaincode is used until transferCar gives it an owner
+
+//setOwnerPolicy makes a peer of the org the endorser every write of the key needs
+func setOwnerPolicy(stub shim.ChaincodeStubInterface, key string, org string) error {
+	if org == "" {
+		return nil
+	}
+	policy, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	if err := policy.AddOrgs(statebased.RoleTypePeer, org); err != nil {
+		return err
+	}
+	policyAsBytes, err := policy.Policy()
+	if err != nil {
+		return err
+	}
+	return stub.SetStateValidationParameter(key, policyAsBytes)
+}
+
+//ownerOrgOfEntry is the OwnerOrg of an imported car or borrow - "" for every other type
+func ownerOrgOfEntry(entityType string, value []byte) string {
+	if entityType != "car" && entityType != "borrow" {
+		return ""
+	}
+	var owned struct {
+		OwnerOrg string `json:"ownerOrg"`
+	}
+	json.Unmarshal(value, &owned)
+	return owned.OwnerOrg
+}
+
+//=====================================TRANSFER CAR===========================================
+func (cc *CRUD) transferCar(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId"
+	//(body) -> args[1]: "Org2MSP" - the MSP ID of the new owner
+	//the transfer itself is a write of the car, so the peers of the old owner have to endorse it
+	//the car stays in the fleet of its tenant, just the endorsement moves to the new owner
+
+	ownerOrg := strings.TrimSpace(args[1])
+	if ownerOrg == "" || strings.ContainsAny(ownerOrg, "/, ") {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "the owner has to be an MSP ID", fieldError("ownerOrg", "has to be an MSP ID"))
+	}
+	//a typo would give the car to an org without peers and nobody could endorse it anymore
+	known, err := isTenant(stub, ownerOrg)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if !known {
+		return Error(http.StatusBadRequest, codeInvalidParameter, ownerOrg+" is no tenant of the channel", fieldError("ownerOrg", "has to be the MSP ID of a registered tenant"))
+	}
+
+	ledgerCar, err := stub.GetState("car" + args[0])
+	if err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found")
+	}
+	var car Car
+	json.Unmarshal(ledgerCar, &car)
+
+	//the open borrow has the policy of the old owner, so a borrowed car is transferred after its return
+	if car.BorrowId != 0 {
+		return Error(http.StatusConflict, codeCarAlreadyBorrowed, "a borrowed car cant be transferred")
+	}
+	if car.OwnerOrg == ownerOrg {
+		return Error(http.StatusConflict, codeInvalidParameter, "the car already belongs to "+ownerOrg)
+	}
+
+	car.OwnerOrg = ownerOrg
+	carAsBytes, _ := json.Marshal(car)
+	if err := stub.PutState("car"+strconv.Itoa(car.Id), carAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if err := setOwnerPolicy(stub, "car"+strconv.Itoa(car.Id), ownerOrg); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Car transferred", carAsBytes)
+	return Success(http.StatusOK, "OK", carAsBytes)
+}
@@ -0,0 +1,46 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//======================================================================================== IDENTITY
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//the role of a caller is the attribute "role" in his certificate (set when he is enrolled)
+const roleAdmin = "admin"
+
+//isAdmin is true if the certificate of the caller has the attribute role=admin
+func isAdmin(stub shim.ChaincodeStubInterface) bool {
+	return cid.AssertAttributeValue(stub, "role", roleAdmin) == nil
+}
+
+//callerId is the unique id of the certificate of the caller - this is written to records made by admins
+func callerId(stub shim.ChaincodeStubInterface) string {
+	id, err := cid.GetID(stub)
+	if err != nil {
+		return "unknown"
+	}
+	return id
+}
+
+//callerUserId is the id of the user the caller is - the attribute "userId" in his certificate
+func callerUserId(stub shim.ChaincodeStubInterface) (int, error) {
+	value, found, err := cid.GetAttributeValue(stub, "userId")
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, errors.New("the certificate of the caller has no userId")
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,303 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//============================================================================================ KEYS
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//who holds a physical key - the key cabinet, a driver (with a borrow of the car) or someone of the fleet staff
+const (
+	keyHolderCabinet = "cabinet"
+	keyHolderDriver  = "driver"
+	keyHolderStaff   = "staff"
+)
+
+//a physical key of a car - ledger key "physKey1_2" for key 2 of car 1, a car can have more than one (e.g. a spare key)
+//HolderUserId and BorrowId are set while a driver holds it, HolderStaff (the id of the caller) while the staff holds it
+type PhysicalKey struct {
+	Id            int    `json:"id"`
+	CarId         int    `json:"carId"`
+	Holder        string `json:"holder"`
+	HolderUserId  int    `json:"holderUserId"`
+	HolderStaff   string `json:"holderStaff"`
+	BorrowId      int    `json:"borrowId"`
+	LastEventId   int    `json:"lastEventId"`
+	Registered    string `json:"registered"`
+	RegisteredBy  string `json:"registeredBy"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//one handover of a key - ledger key "keyEvent1_2_3" for handover 3 of key 2 of car 1
+//the ids are counted by the key (LastEventId), so the handovers of two keys never conflict
+type KeyEvent struct {
+	Id            int    `json:"id"`
+	KeyId         int    `json:"keyId"`
+	CarId         int    `json:"carId"`
+	From          string `json:"from"`
+	FromUserId    int    `json:"fromUserId"`
+	FromStaff     string `json:"fromStaff"`
+	To            string `json:"to"`
+	ToUserId      int    `json:"toUserId"`
+	ToStaff       string `json:"toStaff"`
+	BorrowId      int    `json:"borrowId"`
+	Time          string `json:"time"`
+	RecordedBy    string `json:"recordedBy"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//this one is just for internal Operations in func handOverKey - UserId is the driver for To "driver"
+type CheckKeyHandoverParameter struct {
+	To     string `json:"to"`
+	UserId int    `json:"userId"`
+}
+
+//keysOfCar are the physical keys of a car
+func keysOfCar(stub shim.ChaincodeStubInterface, carId int) ([]PhysicalKey, error) {
+
+	resultsIterator, err := stub.GetStateByRange(scopedRange("physKey", carId))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	keys := []PhysicalKey{}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var key PhysicalKey
+		if err := json.Unmarshal(it.Value, &key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	//the key order is physKey1_1, physKey1_10, physKey1_2
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Id < keys[j].Id })
+	return keys, nil
+}
+
+//keysNotReturned are the keys a driver still holds from a borrow - userReturnACar flags the travelLog if there are any
+func keysNotReturned(stub shim.ChaincodeStubInterface, carBorrow CarBorrow) ([]int, error) {
+	keys, err := keysOfCar(stub, carBorrow.CarId)
+	if err != nil {
+		return nil, err
+	}
+	missing := []int{}
+	for _, key := range keys {
+		if key.Holder == keyHolderDriver && key.BorrowId == carBorrow.Id {
+			missing = append(missing, key.Id)
+		}
+	}
+	return missing, nil
+}
+
+//=====================================REGISTER KEY===========================================
+func (cc *CRUD) registerKey(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId", args[1]: "keyId" - the ids of the keys are counted per car, a new key starts in the cabinet
+
+	carId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven carId cant be converted to an int", fieldError("carId", "has to be an integer"))
+	}
+	keyId, err := strconv.Atoi(args[1])
+	if err != nil || keyId <= 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "the keyId has to be greater than 0", fieldError("keyId", "has to be greater than 0"))
+	}
+	if ledgerCar, err := stub.GetState("car" + strconv.Itoa(carId)); err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found - wrong overgiven carId!")
+	}
+	if obj, err := stub.GetState(scopedKey("physKey", carId, keyId)); err != nil || obj != nil {
+		return Error(http.StatusConflict, codeKeyAlreadyExists, "the car already has a key with this id")
+	}
+
+	key := PhysicalKey{
+		Id:           keyId,
+		CarId:        carId,
+		Holder:       keyHolderCabinet,
+		Registered:   ledgerNow(stub).Format(timeFormat),
+		RegisteredBy: callerId(stub),
+	}
+	keyAsBytes, _ := json.Marshal(key)
+	if err := stub.PutState(scopedKey("physKey", carId, keyId), keyAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Key registered", keyAsBytes)
+	return Success(http.StatusCreated, "Created", keyAsBytes)
+}
+
+//=====================================HAND OVER KEY==========================================
+func (cc *CRUD) handOverKey(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId", args[1]: "keyId"
+	//(body) -> args[2]: {"to":"driver","userId":3} - or {"to":"cabinet"} or {"to":"staff"}
+	//an admin can record every handover - the staff that takes a key is the admin who records it
+	//a driver can record the pickup of a key from the cabinet for his own borrow and the return of his key to the cabinet
+	keyOfLedger, response, ok := scopedKeyOfArgs("physKey", args)
+	if !ok {
+		return response
+	}
+
+	ledgerKey, err := stub.GetState(keyOfLedger)
+	if err != nil || ledgerKey == nil {
+		return Error(http.StatusNotFound, codeKeyNotFound, "Key Not Found")
+	}
+	var key PhysicalKey
+	json.Unmarshal(ledgerKey, &key)
+
+	var overgivenParam CheckKeyHandoverParameter
+	if response, ok := decodeBody("handover", args[2], &overgivenParam); !ok {
+		return response
+	}
+
+	admin := isAdmin(stub)
+	callerUser, callerErr := callerUserId(stub)
+
+	event := KeyEvent{
+		KeyId:      key.Id,
+		CarId:      key.CarId,
+		From:       key.Holder,
+		FromUserId: key.HolderUserId,
+		FromStaff:  key.HolderStaff,
+		To:         overgivenParam.To,
+		Time:       ledgerNow(stub).Format(timeFormat),
+		RecordedBy: callerId(stub),
+	}
+
+	switch overgivenParam.To {
+	case keyHolderDriver:
+		if !admin && (callerErr != nil || callerUser != overgivenParam.UserId) {
+			return Error(http.StatusForbidden, codeAdminRequired, "a driver can only pick up a key for himself")
+		}
+		if key.Holder == keyHolderDriver {
+			return Error(http.StatusConflict, codeKeyHandover, "the key is held by the driver "+strconv.Itoa(key.HolderUserId))
+		}
+		//the staff has to put a key back or hand it over itself
+		if !admin && key.Holder != keyHolderCabinet {
+			return Error(http.StatusForbidden, codeAdminRequired, "the key is held by the staff - a driver can only take a key from the cabinet")
+		}
+
+		//a key is only handed to a driver who borrowed its car
+		ledgerUser, err := stub.GetState("user" + strconv.Itoa(overgivenParam.UserId))
+		if err != nil || ledgerUser == nil {
+			return Error(http.StatusNotFound, codeUserNotFound, "User Not Found - wrong overgiven userId!", fieldError("userId", "is no user"))
+		}
+		var user User
+		json.Unmarshal(ledgerUser, &user)
+		if user.BorrowId == 0 {
+			return Error(http.StatusConflict, codeUserNotBorrowing, "the user has no active borrow to pick up a key for")
+		}
+		var carBorrow CarBorrow
+		ledgerBorrow, _ := stub.GetState("borrow" + strconv.Itoa(user.BorrowId))
+		json.Unmarshal(ledgerBorrow, &carBorrow)
+		if carBorrow.CarId != key.CarId {
+			return Error(http.StatusConflict, codeBorrowMismatch, "the user borrowed another car than the one of the key")
+		}
+
+		event.ToUserId = user.Id
+		event.BorrowId = carBorrow.Id
+		key.HolderUserId, key.HolderStaff, key.BorrowId = user.Id, "", carBorrow.Id
+	case keyHolderCabinet:
+		if !admin && (callerErr != nil || key.Holder != keyHolderDriver || callerUser != key.HolderUserId) {
+			return Error(http.StatusForbidden, codeAdminRequired, "a driver can only put back a key he holds")
+		}
+		if key.Holder == keyHolderCabinet {
+			return Error(http.StatusConflict, codeKeyHandover, "the key is already in the cabinet")
+		}
+		key.HolderUserId, key.HolderStaff, key.BorrowId = 0, "", 0
+	case keyHolderStaff:
+		if !admin {
+			return Error(http.StatusForbidden, codeAdminRequired, "only the fleet staff can take a key")
+		}
+		if key.Holder == keyHolderStaff && key.HolderStaff == callerId(stub) {
+			return Error(http.StatusConflict, codeKeyHandover, "the caller already holds the key")
+		}
+		event.ToStaff = callerId(stub)
+		key.HolderUserId, key.HolderStaff, key.BorrowId = 0, callerId(stub), 0
+	default:
+		return Error(http.StatusBadRequest, codeInvalidParameter, "to has to be cabinet, driver or staff", fieldError("to", "has to be cabinet, driver or staff"))
+	}
+
+	event.Id = key.LastEventId + 1
+	eventAsBytes, _ := json.Marshal(event)
+	if err := stub.PutState(scopedKey("keyEvent", key.CarId, key.Id, event.Id), eventAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	key.Holder = overgivenParam.To
+	key.LastEventId = event.Id
+	keyAsBytes, _ := json.Marshal(key)
+	if err := stub.PutState(keyOfLedger, keyAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Key handed over", eventAsBytes)
+	return Success(http.StatusOK, "OK", eventAsBytes)
+}
+
+//=====================================GET KEYS===============================================
+func (cc *CRUD) getKeys(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId" - the keys of the car with their holder
+	carId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven carId cant be converted to an int")
+	}
+
+	keys, err := keysOfCar(stub, carId)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	keysAsBytes, _ := json.Marshal(keys)
+	return Success(http.StatusOK, "OK", keysAsBytes)
+}
+
+//=====================================GET KEY EVENTS=========================================
+func (cc *CRUD) getKeyEvents(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId", args[1]: "keyId" - the handovers of the key, the oldest first
+	carId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven carId cant be converted to an int")
+	}
+	keyId, err := strconv.Atoi(args[1])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven keyId cant be converted to an int")
+	}
+
+	resultsIterator, err := stub.GetStateByRange(scopedRange("keyEvent", carId, keyId))
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	events := []KeyEvent{}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		var event KeyEvent
+		if err := json.Unmarshal(it.Value, &event); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, "key event "+it.Key+" is broken")
+		}
+		events = append(events, event)
+	}
+
+	//the key order is keyEvent1_2_1, keyEvent1_2_10, keyEvent1_2_2
+	sort.Slice(events, func(i, j int) bool { return events[i].Id < events[j].Id })
+	eventsAsBytes, _ := json.Marshal(events)
+	return Success(http.StatusOK, "OK", eventsAsBytes)
+}
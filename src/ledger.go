@@ -0,0 +1,703 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//============================================================================ LEDGER EXPORT/IMPORT
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//an export says what it is, so importLedger never restores something else
+//the version goes up every time the meaning of an entry changes
+const (
+	exportFormat  = "slowly-ledger"
+	exportVersion = 1
+)
+
+//one page of an export - the whole ledger does not fit into one query answer
+const (
+	defaultExportPageSize = 100
+	maxExportPageSize     = 1000
+)
+
+//ledger key of the running import - it is never exported
+const importStatusKey = "importStatus"
+
+//one page of exportLedger - it is also what importLedger takes
+//NextBookmark is "" on the last page
+type LedgerExport struct {
+	Format       string        `json:"format"`
+	Version      int           `json:"version"`
+	ExportedAt   string        `json:"exportedAt"`
+	Bookmark     string        `json:"bookmark"`
+	NextBookmark string        `json:"nextBookmark"`
+	Entries      []LedgerEntry `json:"entries"`
+}
+
+//one key of the world state - Type is the kind of record the key holds, see entityTypeOfKey
+type LedgerEntry struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+//written with every imported page, the next page has to start where the last one ended
+//Unresolved are keys an imported record points to that were not imported yet
+type ImportStatus struct {
+	Version       int      `json:"version"`
+	NextBookmark  string   `json:"nextBookmark"`
+	Pages         int      `json:"pages"`
+	Entries       int      `json:"entries"`
+	Unresolved    []string `json:"unresolved"`
+	Done          bool     `json:"done"`
+	StartedBy     string   `json:"startedBy"`
+	Started       string   `json:"started"`
+	Finished      string   `json:"finished"`
+	SchemaVersion int      `json:"schemaVersion"`
+}
+
+//one entry importLedger does not accept - Entry starts with 1
+type ImportEntryError struct {
+	Entry int    `json:"entry"`
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+//every kind of record of the ledger
+//numbered ones have the key Prefix + id, exact ones are just the Prefix and the rest starts with the Prefix
+//scoped ones belong to another record and have the key Prefix + its id + "_" + id, see scopedKey
+var ledgerEntityTypes = []struct {
+	Type   string
+	Prefix string
+	Kind   string
+}{
+	{"borrow", "borrow", "numbered"},
+	{"car", "car", "numbered"},
+	{"carDevice", "telematics", "scoped"},
+	{"checklist", "checklist", "prefix"},
+	{"config", "configOdometer", "exact"},
+	{"counter", "counterB", "exact"},
+	{"counter", "counterM", "numbered"},
+	{"counter", "counterO", "exact"},
+	{"counter", "counterR", "numbered"},
+	{"device", "dev", "numbered"},
+	{"keyEvent", "keyEvent", "scoped"},
+	{"logbook", "logbook", "numbered"},
+	{"maintenance", "maintenance", "scoped"},
+	{"nfcCard", "nfcCard", "numbered"},
+	{"nfcNonce", "nfcNonce", "prefix"},
+	{"odoCorrection", "odoCorrection", "numbered"},
+	{"odoOffset", "odoOffset", "numbered"},
+	{"odoReading", "odoReading", "scoped"},
+	{"physKey", "physKey", "scoped"},
+	{"pool", "pool", "numbered"},
+	{"qrToken", "qrToken", "prefix"},
+	{"reservation", "reservation", "scoped"},
+	{"site", "site", "numbered"},
+	{"stats", "stats", "prefix"},
+	{"travelLog", "travelLog", "numbered"},
+	{"user", "user", "numbered"},
+}
+
+//the keys Init writes - only these may be in the ledger when an import starts
+var initKeys = []string{"car1", "car2", "car3", "user1", "user2", "user3", "counterB"}
+
+//entityTypeOfKey is the type of the record of a key or "" if the key is unknown
+func entityTypeOfKey(key string) string {
+	for _, entityType := range ledgerEntityTypes {
+		switch entityType.Kind {
+		case "exact":
+			if key == entityType.Prefix {
+				return entityType.Type
+			}
+		case "prefix":
+			if strings.HasPrefix(key, entityType.Prefix) {
+				return entityType.Type
+			}
+		case "numbered":
+			if !strings.HasPrefix(key, entityType.Prefix) {
+				continue
+			}
+			id, err := strconv.Atoi(key[len(entityType.Prefix):])
+			if err == nil && id > 0 && entityType.Prefix+strconv.Itoa(id) == key {
+				return entityType.Type
+			}
+		case "scoped":
+			if !strings.HasPrefix(key, entityType.Prefix) {
+				continue
+			}
+			ids := []int{}
+			for _, part := range strings.Split(key[len(entityType.Prefix):], "_") {
+				id, err := strconv.Atoi(part)
+				if err != nil || id <= 0 {
+					break
+				}
+				ids = append(ids, id)
+			}
+			if len(ids) > 1 && scopedKey(entityType.Prefix, ids...) == key {
+				return entityType.Type
+			}
+		}
+	}
+	return ""
+}
+
+//scopedKey is the key of a record that belongs to another one, e.g. "odoReading3_12" is reading 12 of box 3
+//the records of one parent are one range, so they are read without a scan of the fleet
+//and the ids come from the parent, so two parents never write the same counter
+func scopedKey(prefix string, ids ...int) string {
+	key := prefix
+	for i, id := range ids {
+		if i != 0 {
+			key += "_"
+		}
+		key += strconv.Itoa(id)
+	}
+	return key
+}
+
+//scopedRange is the range of GetStateByRange for the records of one parent - "`" comes right after "_"
+func scopedRange(prefix string, ids ...int) (string, string) {
+	key := scopedKey(prefix, ids...)
+	return key + "_", key + "`"
+}
+
+//deleteRange deletes every key from startKey to endKey
+func deleteRange(stub shim.ChaincodeStubInterface, startKey string, endKey string) error {
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		if err := stub.DelState(it.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//checkLedgerEntry validates the value of an entry and returns the keys it points to
+//and the value to write - an older schemaVersion is upgraded to the current one
+func checkLedgerEntry(entry LedgerEntry) ([]string, []byte, error) {
+
+	entityType := entityTypeOfKey(entry.Key)
+	if entityType == "" {
+		return nil, nil, errors.New("unknown key")
+	}
+	if entityType != entry.Type {
+		return nil, nil, errors.New("a key like this holds a " + entityType + " and not a " + entry.Type)
+	}
+
+	//the id in the record has to be the one of the key
+	checkId := func(prefix string, id int) error {
+		if prefix+strconv.Itoa(id) != entry.Key {
+			return errors.New("the id of the record does not match the key")
+		}
+		return nil
+	}
+	//a scoped record has the id of its parent in the key as well
+	checkScopedId := func(prefix string, ids ...int) error {
+		if scopedKey(prefix, ids...) != entry.Key {
+			return errors.New("the ids of the record do not match the key")
+		}
+		return nil
+	}
+	refs := []string{}
+	var document interface{}
+	refIfSet := func(prefix string, id int) {
+		if id != 0 {
+			refs = append(refs, prefix+strconv.Itoa(id))
+		}
+	}
+
+	switch entityType {
+	case "car":
+		var car Car
+		if err := decodeStrictDocument(entry.Value, &car); err != nil {
+			return nil, nil, err
+		}
+		document = car
+		if err := checkId("car", car.Id); err != nil {
+			return nil, nil, err
+		}
+		refIfSet("borrow", car.BorrowId)
+		refIfSet("pool", car.PoolId)
+		refIfSet("site", car.Location.SiteId)
+	case "user":
+		var user User
+		if err := decodeStrictDocument(entry.Value, &user); err != nil {
+			return nil, nil, err
+		}
+		document = user
+		if err := checkId("user", user.Id); err != nil {
+			return nil, nil, err
+		}
+		refIfSet("borrow", user.BorrowId)
+		for _, poolId := range user.Pools {
+			refIfSet("pool", poolId)
+		}
+	case "borrow":
+		var carBorrow CarBorrow
+		if err := decodeStrictDocument(entry.Value, &carBorrow); err != nil {
+			return nil, nil, err
+		}
+		document = carBorrow
+		if err := checkId("borrow", carBorrow.Id); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(carBorrow.CarId), "user"+strconv.Itoa(carBorrow.UserId))
+		refIfSet("site", carBorrow.PickupLocation.SiteId)
+	case "travelLog":
+		var travelLog TravelLog
+		if err := decodeStrictDocument(entry.Value, &travelLog); err != nil {
+			return nil, nil, err
+		}
+		document = travelLog
+		if err := checkId("travelLog", travelLog.Id); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(travelLog.CarId), "user"+strconv.Itoa(travelLog.UserId))
+		refIfSet("travelLog", travelLog.PrevLogId)
+	case "logbook":
+		var logbook Logbook
+		if err := decodeStrictDocument(entry.Value, &logbook); err != nil {
+			return nil, nil, err
+		}
+		document = logbook
+		if err := checkId("logbook", logbook.CarId); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(logbook.CarId))
+		refIfSet("travelLog", logbook.LastLogId)
+	case "odoCorrection":
+		var correction OdometerCorrection
+		if err := decodeStrictDocument(entry.Value, &correction); err != nil {
+			return nil, nil, err
+		}
+		document = correction
+		if err := checkId("odoCorrection", correction.Id); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(correction.CarId))
+	case "odoOffset":
+		var offset OdometerOffset
+		if err := decodeStrictDocument(entry.Value, &offset); err != nil {
+			return nil, nil, err
+		}
+		document = offset
+		if err := checkId("odoOffset", offset.CarId); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(offset.CarId))
+	case "reservation":
+		var reservation Reservation
+		if err := decodeStrictDocument(entry.Value, &reservation); err != nil {
+			return nil, nil, err
+		}
+		document = reservation
+		if err := checkScopedId("reservation", reservation.CarId, reservation.Id); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(reservation.CarId), "user"+strconv.Itoa(reservation.UserId))
+	case "maintenance":
+		var maintenance MaintenanceBlock
+		if err := decodeStrictDocument(entry.Value, &maintenance); err != nil {
+			return nil, nil, err
+		}
+		document = maintenance
+		if err := checkScopedId("maintenance", maintenance.CarId, maintenance.Id); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(maintenance.CarId))
+	case "device":
+		var device TelematicsDevice
+		if err := decodeStrictDocument(entry.Value, &device); err != nil {
+			return nil, nil, err
+		}
+		document = device
+		if err := checkId("dev", device.Id); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(device.CarId))
+		if device.LastReadingId != 0 {
+			refs = append(refs, scopedKey("odoReading", device.Id, device.LastReadingId))
+		}
+	case "nfcCard":
+		var card NfcCard
+		if err := decodeStrictDocument(entry.Value, &card); err != nil {
+			return nil, nil, err
+		}
+		document = card
+		if err := checkId("nfcCard", card.Id); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "user"+strconv.Itoa(card.UserId))
+	case "nfcNonce":
+		var challenge NfcChallenge
+		if err := decodeStrictDocument(entry.Value, &challenge); err != nil {
+			return nil, nil, err
+		}
+		document = challenge
+		if "nfcNonce"+challenge.Nonce != entry.Key {
+			return nil, nil, errors.New("the nonce of the record does not match the key")
+		}
+		refs = append(refs, "car"+strconv.Itoa(challenge.CarId))
+	case "qrToken":
+		var qrToken QrToken
+		if err := decodeStrictDocument(entry.Value, &qrToken); err != nil {
+			return nil, nil, err
+		}
+		document = qrToken
+		if "qrToken"+qrToken.TokenHash != entry.Key {
+			return nil, nil, errors.New("the token of the record does not match the key")
+		}
+		refs = append(refs, "car"+strconv.Itoa(qrToken.CarId))
+	case "checklist":
+		var template ChecklistTemplate
+		if err := decodeStrictDocument(entry.Value, &template); err != nil {
+			return nil, nil, err
+		}
+		document = template
+		if "checklist"+template.Category != entry.Key {
+			return nil, nil, errors.New("the category of the checklist does not match the key")
+		}
+	case "physKey":
+		var key PhysicalKey
+		if err := decodeStrictDocument(entry.Value, &key); err != nil {
+			return nil, nil, err
+		}
+		document = key
+		if err := checkScopedId("physKey", key.CarId, key.Id); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(key.CarId))
+		refIfSet("user", key.HolderUserId)
+		refIfSet("borrow", key.BorrowId)
+		if key.LastEventId != 0 {
+			refs = append(refs, scopedKey("keyEvent", key.CarId, key.Id, key.LastEventId))
+		}
+	case "keyEvent":
+		var event KeyEvent
+		if err := decodeStrictDocument(entry.Value, &event); err != nil {
+			return nil, nil, err
+		}
+		document = event
+		if err := checkScopedId("keyEvent", event.CarId, event.KeyId, event.Id); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, scopedKey("physKey", event.CarId, event.KeyId), "car"+strconv.Itoa(event.CarId))
+		refIfSet("user", event.FromUserId)
+		refIfSet("user", event.ToUserId)
+		refIfSet("borrow", event.BorrowId)
+	case "carDevice":
+		var carDevice CarDevice
+		if err := decodeStrictDocument(entry.Value, &carDevice); err != nil {
+			return nil, nil, err
+		}
+		document = carDevice
+		if err := checkScopedId("telematics", carDevice.CarId, carDevice.DeviceId); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(carDevice.CarId))
+	case "odoReading":
+		var reading OdometerReading
+		if err := decodeStrictDocument(entry.Value, &reading); err != nil {
+			return nil, nil, err
+		}
+		document = reading
+		if err := checkScopedId("odoReading", reading.DeviceId, reading.Id); err != nil {
+			return nil, nil, err
+		}
+		refs = append(refs, "car"+strconv.Itoa(reading.CarId))
+	case "site":
+		var site Site
+		if err := decodeStrictDocument(entry.Value, &site); err != nil {
+			return nil, nil, err
+		}
+		document = site
+		if err := checkId("site", site.Id); err != nil {
+			return nil, nil, err
+		}
+	case "pool":
+		var pool Pool
+		if err := decodeStrictDocument(entry.Value, &pool); err != nil {
+			return nil, nil, err
+		}
+		document = pool
+		if err := checkId("pool", pool.Id); err != nil {
+			return nil, nil, err
+		}
+	case "config":
+		var rules OdometerRules
+		if err := decodeStrictDocument(entry.Value, &rules); err != nil {
+			return nil, nil, err
+		}
+		document = rules
+	case "counter":
+		var counter int
+		if err := decodeStrict(entry.Value, &counter); err != nil || counter < 0 {
+			return nil, nil, errors.New("a counter has to be an int of at least 0")
+		}
+		document = counter
+	case "stats":
+		var stats UsageStats
+		if err := decodeStrictDocument(entry.Value, &stats); err != nil {
+			return nil, nil, err
+		}
+		document = stats
+	}
+	documentAsBytes, _ := json.Marshal(document)
+	return refs, documentAsBytes, nil
+}
+
+//checkFreshLedger is ok if the ledger has nothing but what Init wrote
+func checkFreshLedger(stub shim.ChaincodeStubInterface) error {
+
+	resultsIterator, err := stub.GetStateByRange("", "")
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	allowed := map[string]bool{}
+	for _, key := range initKeys {
+		allowed[key] = true
+	}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		if !allowed[it.Key] {
+			return errors.New("the ledger is not fresh, it already has " + it.Key)
+		}
+	}
+	return nil
+}
+
+//=====================================EXPORT LEDGER==========================================
+func (cc *CRUD) exportLedger(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(query) -> args[0]: "pageSize" - "" is 100
+	//(query) -> args[1]: "bookmark" - "" is the first page, then the nextBookmark of the page before
+	//the personal data of the private data collection is not part of the export
+
+	pageSize := defaultExportPageSize
+	if args[0] != "" {
+		overgivenPageSize, err := strconv.Atoi(args[0])
+		if err != nil || overgivenPageSize < 1 || overgivenPageSize > maxExportPageSize {
+			return Error(http.StatusBadRequest, codeInvalidParameter, "pageSize has to be between 1 and "+strconv.Itoa(maxExportPageSize))
+		}
+		pageSize = overgivenPageSize
+	}
+
+	resultsIterator, metadata, err := stub.GetStateByRangeWithPagination("", "", int32(pageSize), args[1])
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	export := LedgerExport{
+		Format:     exportFormat,
+		Version:    exportVersion,
+		ExportedAt: ledgerNow(stub).Format(timeFormat),
+		Bookmark:   args[1],
+		Entries:    []LedgerEntry{},
+	}
+
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+
+		if it.Key == importStatusKey {
+			continue
+		}
+		//a broken value is exported as a JSON string, importLedger tells what is wrong with it
+		value := json.RawMessage(it.Value)
+		if !json.Valid(it.Value) {
+			value, _ = json.Marshal(string(it.Value))
+		}
+		export.Entries = append(export.Entries, LedgerEntry{Key: it.Key, Type: entityTypeOfKey(it.Key), Value: value})
+	}
+
+	//a page that is not full is the last one - counted by the ledger, the home tenant skips the keys of
+	//the other tenants, so its page can have less entries and still not be the last one
+	if metadata != nil && int(metadata.FetchedRecordsCount) == pageSize {
+		export.NextBookmark = metadata.Bookmark
+	}
+
+	exportAsBytes, _ := json.Marshal(export)
+	return Success(http.StatusOK, "OK", exportAsBytes)
+}
+
+//=====================================IMPORT LEDGER==========================================
+func (cc *CRUD) importLedger(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(body) -> args[0]: one page of exportLedger - the pages have to be imported in their order
+	//the first page only works on a fresh channel with nothing but the records of Init, these are replaced
+	//a page is imported completely or not at all - the last one only if every key a record points to exists
+
+	var export LedgerExport
+	if response, ok := decodeBody("page", args[0], &export); !ok {
+		return response
+	}
+	if export.Format != exportFormat {
+		return Error(http.StatusBadRequest, codeInvalidExport, "this is not an export of this chaincode")
+	}
+	if export.Version < 1 || export.Version > exportVersion {
+		return Error(http.StatusBadRequest, codeInvalidExport, "export version "+strconv.Itoa(export.Version)+" is not supported")
+	}
+
+	var status ImportStatus
+	ledgerStatus, err := stub.GetState(importStatusKey)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	firstPage := ledgerStatus == nil
+	if firstPage {
+		if export.Bookmark != "" {
+			return Error(http.StatusConflict, codeImportOrder, "an import has to start with the first page of the export")
+		}
+		if err := checkFreshLedger(stub); err != nil {
+			return Error(http.StatusConflict, codeLedgerNotFresh, err.Error())
+		}
+		status = ImportStatus{Version: export.Version, Unresolved: []string{}, StartedBy: callerId(stub), Started: ledgerNow(stub).Format(timeFormat)}
+	} else {
+		json.Unmarshal(ledgerStatus, &status)
+		if status.Done {
+			return Error(http.StatusConflict, codeImportDone, "the ledger is already imported")
+		}
+		if export.Bookmark != status.NextBookmark || export.Version != status.Version {
+			return Error(http.StatusConflict, codeImportOrder, "the next page of the import is the one with the bookmark "+status.NextBookmark)
+		}
+	}
+
+	//check every entry, so the admin gets all errors at once
+	entryErrors := []ImportEntryError{}
+	pageKeys := map[string]bool{}
+	refs := map[string]bool{}
+	values := map[string][]byte{}
+	for i, entry := range export.Entries {
+		if pageKeys[entry.Key] {
+			entryErrors = append(entryErrors, ImportEntryError{Entry: i + 1, Key: entry.Key, Error: "the key is more than once in the page"})
+			continue
+		}
+		pageKeys[entry.Key] = true
+
+		entryRefs, value, err := checkLedgerEntry(entry)
+		if err != nil {
+			entryErrors = append(entryErrors, ImportEntryError{Entry: i + 1, Key: entry.Key, Error: err.Error()})
+			continue
+		}
+		for _, ref := range entryRefs {
+			refs[ref] = true
+		}
+		values[entry.Key] = value
+
+		//the records of Init are replaced by the first page, anything else must not be there yet
+		if !firstPage {
+			if obj, err := stub.GetState(entry.Key); err != nil || obj != nil {
+				entryErrors = append(entryErrors, ImportEntryError{Entry: i + 1, Key: entry.Key, Error: "the key is already imported"})
+			}
+		}
+	}
+	if len(entryErrors) != 0 {
+		errorsAsBytes, _ := json.Marshal(entryErrors)
+		return ErrorWithData(http.StatusBadRequest, codeInvalidExport, strconv.Itoa(len(entryErrors))+" entries are invalid - nothing was imported", errorsAsBytes)
+	}
+
+	//a write is not visible to GetState in the same transaction, so the keys of this page are checked on their own
+	//on the first page the records of Init are going to be deleted, so they dont count
+	initKey := map[string]bool{}
+	for _, key := range initKeys {
+		initKey[key] = true
+	}
+	unresolved := map[string]bool{}
+	for _, key := range status.Unresolved {
+		if !pageKeys[key] {
+			unresolved[key] = true
+		}
+	}
+	for ref := range refs {
+		if pageKeys[ref] {
+			continue
+		}
+		if firstPage && initKey[ref] {
+			unresolved[ref] = true
+			continue
+		}
+		if obj, err := stub.GetState(ref); err != nil || obj == nil {
+			unresolved[ref] = true
+		}
+	}
+	status.Unresolved = []string{}
+	for key := range unresolved {
+		status.Unresolved = append(status.Unresolved, key)
+	}
+	sort.Strings(status.Unresolved)
+
+	lastPage := export.NextBookmark == ""
+	if lastPage && len(status.Unresolved) != 0 {
+		return Error(http.StatusBadRequest, codeReferentialIntegrity, "referential integrity violated - these keys are pointed to but were never imported: "+strings.Join(status.Unresolved, ", "))
+	}
+
+	if firstPage {
+		for _, key := range initKeys {
+			if pageKeys[key] {
+				continue
+			}
+			if err := stub.DelState(key); err != nil {
+				return Error(http.StatusInternalServerError, codeInternal, err.Error())
+			}
+		}
+		//the personal data of the test users does not belong to the imported users
+		for _, key := range []string{"user1", "user2", "user3"} {
+			if err := stub.DelPrivateData(collectionUserPII, key); err != nil {
+				return Error(http.StatusInternalServerError, codeInternal, err.Error())
+			}
+		}
+	}
+
+	for _, entry := range export.Entries {
+		if err := stub.PutState(entry.Key, values[entry.Key]); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		//the policies are not in the export, an imported car or borrow gets the one of its owner again
+		if err := setOwnerPolicy(stub, entry.Key, ownerOrgOfEntry(entry.Type, values[entry.Key])); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+	}
+
+	status.NextBookmark = export.NextBookmark
+	status.Pages += 1
+	status.Entries += len(export.Entries)
+	if lastPage {
+		status.Done = true
+		status.Finished = ledgerNow(stub).Format(timeFormat)
+	}
+	statusAsBytes, _ := json.Marshal(status)
+	if err := stub.PutState(importStatusKey, statusAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Ledger page imported", []byte("page: "+strconv.Itoa(status.Pages)+" entries: "+strconv.Itoa(len(export.Entries))))
+	return Success(http.StatusOK, "OK", statusAsBytes)
+}
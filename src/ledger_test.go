@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//pagedStub pages GetStateByRange like the peer does - the MockStub has no pagination
+type pagedStub struct {
+	*shim.MockStub
+}
+
+type pageIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *pageIterator) HasNext() bool { return len(it.kvs) > 0 }
+
+func (it *pageIterator) Next() (*queryresult.KV, error) {
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func (it *pageIterator) Close() error { return nil }
+
+func (s *pagedStub) GetStateByRangeWithPagination(startKey string, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if bookmark != "" {
+		startKey = bookmark
+	}
+	if endKey == "" {
+		//the peer takes "" as the end of the ledger
+		endKey = string(utf8.MaxRune)
+	}
+	iterator, err := s.MockStub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iterator.Close()
+
+	page := &pageIterator{}
+	metadata := &peer.QueryResponseMetadata{}
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if int32(len(page.kvs)) == pageSize {
+			//the bookmark is the first key of the next page, "" after the last one
+			metadata.Bookmark = kv.Key
+			break
+		}
+		page.kvs = append(page.kvs, kv)
+	}
+	metadata.FetchedRecordsCount = int32(len(page.kvs))
+	return page, metadata, nil
+}
+
+func TestExportLedgerSkipsOtherTenants(t *testing.T) {
+	stub := &pagedStub{shim.NewMockStub("slowly", new(CRUD))}
+	stub.MockTransactionStart("setup")
+	for _, key := range []string{"car1", "car2", "counterC", "tenantAuditors", "tenantHome", "tenant/Org2MSP/car1", "tenant/Org2MSP/user1", "tenants/Org2MSP", "travelLog1", "user1"} {
+		stub.PutState(key, []byte(`{}`))
+	}
+	stub.PutState(tenantHomeKey, []byte("Org1MSP"))
+	stub.MockTransactionEnd("setup")
+	home := &tenantStub{ChaincodeStubInterface: stub, tenant: "Org1MSP"}
+
+	exported := []string{}
+	bookmark := ""
+	for page := 0; page < 10; page++ {
+		response := new(CRUD).exportLedger(home, []string{"2", bookmark})
+		if response.Status != 200 {
+			t.Fatalf("page %d: %d %s", page, response.Status, response.Message)
+		}
+		var envelope Envelope
+		var export LedgerExport
+		json.Unmarshal(response.Payload, &envelope)
+		json.Unmarshal(envelope.Data, &export)
+		for _, entry := range export.Entries {
+			exported = append(exported, entry.Key)
+		}
+		if export.NextBookmark == "" {
+			break
+		}
+		bookmark = export.NextBookmark
+	}
+
+	want := []string{"car1", "car2", "counterC", "travelLog1", "user1"}
+	if len(exported) != len(want) {
+		t.Fatalf("exported %v, want %v", exported, want)
+	}
+	for i := range want {
+		if exported[i] != want[i] {
+			t.Fatalf("exported %v, want %v", exported, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//========================================================================================= LICENCE
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//the expiry date of a licence has no time
+const dateFormat = "2006-01-02"
+
+//a car without a category needs a normal car licence
+const defaultLicenceClass = "B"
+
+//the insurance wants the licence to be checked by an admin at least every 6 months
+const licenceVerificationMaxAge = 180 * 24 * time.Hour
+
+//this one is just for internal Operations in func verifyLicence
+//Classes are all classes on the licence card - a card lists every class the driver holds (B is on it next to BE)
+type CheckVerifyLicenceParameter struct {
+	Classes []string `json:"classes"`
+	Expiry  string   `json:"expiry"`
+}
+
+//checkLicence returns why the user is not allowed to drive the car at the overgiven time or "" if he is
+func checkLicence(user User, car Car, now time.Time) string {
+
+	if user.LicenceVerified == "" {
+		return "the licence of the user was never verified"
+	}
+
+	verified, err := time.Parse(timeFormat, user.LicenceVerified)
+	if err != nil {
+		return "the verification date of the licence is broken"
+	}
+	if now.Sub(verified) > licenceVerificationMaxAge {
+		return "the licence of the user was verified on " + user.LicenceVerified + " and has to be verified again"
+	}
+
+	expiry, err := time.Parse(dateFormat, user.LicenceExpiry)
+	if err != nil {
+		return "the expiry date of the licence is broken"
+	}
+	//the licence is valid until the end of its expiry day
+	if !now.Before(expiry.AddDate(0, 0, 1)) {
+		return "the licence of the user expired on " + user.LicenceExpiry
+	}
+
+	category := car.Category
+	if category == "" {
+		category = defaultLicenceClass
+	}
+	for _, class := range user.LicenceClasses {
+		if strings.EqualFold(class, category) {
+			return ""
+		}
+	}
+	return "the licence of the user has no class " + category + " for this car"
+}
+
+//=====================================VERIFY LICENCE=========================================
+func (cc *CRUD) verifyLicence(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "userId"
+	//(body) -> args[1]: {"classes":["AM","B","BE"],"expiry":"2033-01-19"}
+
+	ledgerUser, err := stub.GetState("user" + args[0])
+	if err != nil || ledgerUser == nil {
+		return Error(http.StatusNotFound, codeUserNotFound, "User Not Found")
+	}
+	var user User
+	json.Unmarshal(ledgerUser, &user)
+	if user.Erased {
+		return Error(http.StatusGone, codeUserErased, "the user was erased")
+	}
+
+	var overgivenParam CheckVerifyLicenceParameter
+	if response, ok := decodeBody("licence", args[1], &overgivenParam); !ok {
+		return response
+	}
+	if len(overgivenParam.Classes) == 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "a licence needs at least one class")
+	}
+	if _, err := time.Parse(dateFormat, overgivenParam.Expiry); err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "expiry has to be a date like "+dateFormat)
+	}
+
+	classes := []string{}
+	for _, class := range overgivenParam.Classes {
+		class = strings.ToUpper(strings.TrimSpace(class))
+		if class == "" {
+			return Error(http.StatusBadRequest, codeInvalidParameter, "a licence class cant be empty")
+		}
+		classes = append(classes, class)
+	}
+
+	user.LicenceClasses = classes
+	user.LicenceExpiry = overgivenParam.Expiry
+	user.LicenceVerified = ledgerNow(stub).Format(timeFormat)
+	user.LicenceVerifiedBy = callerId(stub)
+
+	userAsBytes, _ := json.Marshal(user)
+	if err := stub.PutState("user"+strconv.Itoa(user.Id), userAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, "Update user failed")
+	}
+
+	stub.SetEvent("Licence verified", []byte("user: "+args[0]+" classes: "+strings.Join(classes, ",")+" expiry: "+user.LicenceExpiry))
+	return Success(http.StatusOK, "OK", []byte("Licence verified"))
+}
@@ -0,0 +1,214 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//======================================================================================== LOCATION
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//a registered branch where cars are picked up and dropped off - ledger key "site1"
+type Site struct {
+	Id            int     `json:"id"`
+	Name          string  `json:"name"`
+	Lat           float64 `json:"lat"`
+	Long          float64 `json:"long"`
+	SchemaVersion int     `json:"schemaVersion"`
+}
+
+//a location is a registered site or just lat/long
+type Location struct {
+	SiteId int     `json:"siteId"`
+	Lat    float64 `json:"lat"`
+	Long   float64 `json:"long"`
+}
+
+//radius in km getCarsAtLocation uses if no radius is overgiven
+const defaultLocationRadius = 1.0
+
+func (location Location) isEmpty() bool {
+	return location.SiteId == 0 && location.Lat == 0 && location.Long == 0
+}
+
+//resolveLocation checks an overgiven location and fills in lat/long of a site
+func resolveLocation(stub shim.ChaincodeStubInterface, location Location) (Location, error) {
+
+	if location.isEmpty() {
+		return location, nil
+	}
+
+	if location.SiteId != 0 {
+		ledgerSite, err := stub.GetState("site" + strconv.Itoa(location.SiteId))
+		if err != nil {
+			return location, err
+		}
+		if ledgerSite == nil {
+			return location, errors.New("site " + strconv.Itoa(location.SiteId) + " does not exist")
+		}
+
+		var site Site
+		json.Unmarshal(ledgerSite, &site)
+		return Location{SiteId: site.Id, Lat: site.Lat, Long: site.Long}, nil
+	}
+
+	if location.Lat < -90 || location.Lat > 90 || location.Long < -180 || location.Long > 180 {
+		return location, errors.New("lat has to be between -90 and 90 and long between -180 and 180")
+	}
+	return location, nil
+}
+
+//distanceKm is the great circle distance between two locations
+func distanceKm(a Location, b Location) float64 {
+	const earthRadius = 6371.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(b.Lat - a.Lat)
+	dLong := toRad(b.Long - a.Long)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(a.Lat))*math.Cos(toRad(b.Lat))*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+//=====================================CREATE SITE============================================
+func (cc *CRUD) createSite(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "id"
+	//(body) -> args[1]: {"id":1,"name":"Walldorf","lat":49.29,"long":8.64}
+
+	if obj, err := stub.GetState("site" + args[0]); err != nil || obj != nil {
+		return Error(http.StatusConflict, codeSiteAlreadyExists, "a site with this id already exists")
+	}
+
+	var site Site
+	if response, ok := decodeBody("site", args[1], documentFields(&site)); !ok {
+		return response
+	}
+	details := []FieldError{}
+	if site.Id <= 0 {
+		details = append(details, fieldError("id", "has to be greater than 0"))
+	}
+	if site.Name == "" {
+		details = append(details, fieldError("name", "cant be empty"))
+	}
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
+	}
+	if strconv.Itoa(site.Id) != args[0] {
+		return Error(http.StatusBadRequest, codeIdMismatch, "id of path and id of site are different!")
+	}
+	if _, err := resolveLocation(stub, Location{Lat: site.Lat, Long: site.Long}); err != nil {
+		return Error(http.StatusBadRequest, codeInvalidLocation, err.Error())
+	}
+
+	siteAsBytes, _ := json.Marshal(site)
+	if err := stub.PutState("site"+args[0], siteAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Site created", siteAsBytes)
+	return Success(http.StatusCreated, "Created", nil)
+}
+
+//=====================================GET ALL SITES==========================================
+func (cc *CRUD) getAllSites(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+
+	resultsIterator, err := stub.GetStateByRange("site", "sitf")
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	sites := []Site{}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+
+		var site Site
+		json.Unmarshal(it.Value, &site)
+		sites = append(sites, site)
+	}
+
+	sitesAsBytes, _ := json.Marshal(sites)
+	return Success(http.StatusOK, "OK", sitesAsBytes)
+}
+
+//=====================================GET CARS AT LOCATION===================================
+func (cc *CRUD) getCarsAtLocation(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(query) -> args[0]: "siteId" or ""
+	//(query) -> args[1]: "lat", args[2]: "long", args[3]: "radius" in km - only used without siteId
+
+	var center Location
+	radius := defaultLocationRadius
+	if args[0] != "" {
+		siteId, err := strconv.Atoi(args[0])
+		if err != nil {
+			return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven siteId cant be converted to an int")
+		}
+		center.SiteId = siteId
+	} else {
+		lat, errLat := strconv.ParseFloat(args[1], 64)
+		long, errLong := strconv.ParseFloat(args[2], 64)
+		if errLat != nil || errLong != nil {
+			return Error(http.StatusBadRequest, codeInvalidParameter, "a siteId or lat and long are needed")
+		}
+		center.Lat = lat
+		center.Long = long
+
+		if args[3] != "" {
+			overgivenRadius, err := strconv.ParseFloat(args[3], 64)
+			if err != nil || overgivenRadius <= 0 {
+				return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven radius has to be a number greater than 0")
+			}
+			radius = overgivenRadius
+		}
+	}
+
+	center, err := resolveLocation(stub, center)
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidLocation, err.Error())
+	}
+
+	//safe in resultsIterator all avaible keys for cars
+	resultsIterator, err := stub.GetStateByRange("car", "caw")
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	cars := []Car{}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+
+		var car Car
+		json.Unmarshal(it.Value, &car)
+		if car.Location.isEmpty() {
+			continue
+		}
+
+		if center.SiteId != 0 {
+			if car.Location.SiteId == center.SiteId {
+				cars = append(cars, car)
+			}
+		} else if distanceKm(center, car.Location) <= radius {
+			cars = append(cars, car)
+		}
+	}
+
+	carsAsBytes, _ := json.Marshal(cars)
+	return Success(http.StatusOK, "OK", carsAsBytes)
+}
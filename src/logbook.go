@@ -0,0 +1,298 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//========================================================================= LOGBOOK (FAHRTENBUCH)
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//the classification of a trip the german tax authority wants to see
+const (
+	tripTypeBusiness = "business"
+	tripTypePrivate  = "private"
+	tripTypeCommute  = "commute"
+)
+
+//the rules a logbook report can flag
+const (
+	ruleClassification  = "classification"
+	ruleBusinessDetails = "businessDetails"
+	ruleOdometerGap     = "odometerGap"
+	ruleIntegrity       = "integrity"
+	ruleModified        = "modified"
+)
+
+//one per car - ledger key "logbook1"
+//the last travelLog of the car is saved here, every new travelLog is chained to it
+type Logbook struct {
+	CarId         int    `json:"carId"`
+	Enabled       bool   `json:"enabled"`
+	LastLogId     int    `json:"lastLogId"`
+	LastEndKm     int    `json:"lastEndKm"`
+	LastHash      string `json:"lastHash"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+type LogbookViolation struct {
+	TravelLogId int    `json:"travelLogId"`
+	Rule        string `json:"rule"`
+	Detail      string `json:"detail"`
+}
+
+//this one is just the answer of getLogbook
+type LogbookReport struct {
+	CarId       int                  `json:"carId"`
+	Year        int                  `json:"year"`
+	Enabled     bool                 `json:"enabled"`
+	Entries     []TravelLog          `json:"entries"`
+	Corrections []OdometerCorrection `json:"corrections"`
+	Violations  []LogbookViolation   `json:"violations"`
+}
+
+//getLogbookOfCar reads the logbook of a car - a car without one gets an empty logbook
+func getLogbookOfCar(stub shim.ChaincodeStubInterface, carId int) (Logbook, error) {
+
+	logbook := Logbook{CarId: carId}
+	ledgerLogbook, err := stub.GetState("logbook" + strconv.Itoa(carId))
+	if err != nil {
+		return logbook, err
+	}
+	if ledgerLogbook != nil {
+		err = json.Unmarshal(ledgerLogbook, &logbook)
+	}
+	return logbook, err
+}
+
+func putLogbook(stub shim.ChaincodeStubInterface, logbook Logbook) error {
+	logbookAsBytes, _ := json.Marshal(logbook)
+	return stub.PutState("logbook"+strconv.Itoa(logbook.CarId), logbookAsBytes)
+}
+
+//travelLogHash only uses the fields the logbook is about, so new fields in TravelLog dont break old hashes
+func travelLogHash(travelLog TravelLog) string {
+	fields := []string{
+		strconv.Itoa(travelLog.Id),
+		strconv.Itoa(travelLog.UserId),
+		strconv.Itoa(travelLog.CarId),
+		travelLog.Usage,
+		travelLog.TripType,
+		travelLog.BusinessPartner,
+		travelLog.Route,
+		strconv.Itoa(travelLog.StartKm),
+		strconv.Itoa(travelLog.EndKm),
+		strconv.Itoa(travelLog.DrivenKm),
+		travelLog.StartTime,
+		travelLog.EndTime,
+		strconv.Itoa(travelLog.PrevLogId),
+		travelLog.PrevHash,
+	}
+	hash := sha256.Sum256([]byte(strings.Join(fields, "|")))
+	return hex.EncodeToString(hash[:])
+}
+
+//logbookRuleViolations checks a single travelLog against the rules of an electronic Fahrtenbuch
+//prevEndKm is only checked if hasPrev is true - the first trip of a car has nothing to continue
+func logbookRuleViolations(travelLog TravelLog, hasPrev bool, prevEndKm int) []LogbookViolation {
+
+	var violations []LogbookViolation
+	add := func(rule string, detail string) {
+		violations = append(violations, LogbookViolation{TravelLogId: travelLog.Id, Rule: rule, Detail: detail})
+	}
+
+	switch travelLog.TripType {
+	case tripTypeBusiness:
+		if travelLog.BusinessPartner == "" {
+			add(ruleBusinessDetails, "a business trip needs a businessPartner")
+		}
+		if travelLog.Route == "" {
+			add(ruleBusinessDetails, "a business trip needs a route")
+		}
+	case tripTypePrivate, tripTypeCommute:
+	default:
+		add(ruleClassification, "tripType must be business, private or commute but is '"+travelLog.TripType+"'")
+	}
+
+	if hasPrev && travelLog.StartKm != prevEndKm {
+		add(ruleOdometerGap, "startKm "+strconv.Itoa(travelLog.StartKm)+" does not continue endKm "+strconv.Itoa(prevEndKm)+" of the trip before")
+	}
+	return violations
+}
+
+//chainTravelLog links a new travelLog to the last one of its car and moves the logbook forward
+func chainTravelLog(stub shim.ChaincodeStubInterface, logbook *Logbook, travelLog *TravelLog) error {
+
+	travelLog.PrevLogId = logbook.LastLogId
+	travelLog.PrevHash = logbook.LastHash
+	travelLog.Hash = travelLogHash(*travelLog)
+
+	logbook.LastLogId = travelLog.Id
+	logbook.LastEndKm = travelLog.EndKm
+	logbook.LastHash = travelLog.Hash
+	return putLogbook(stub, *logbook)
+}
+
+//=====================================SET LOGBOOK MODE=======================================
+func (cc *CRUD) setLogbookMode(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId"
+	//(body) -> args[1]: "true" or "false"
+
+	carId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven carId cant be converted to an int")
+	}
+	enabled, err := strconv.ParseBool(args[1])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven mode must be true or false")
+	}
+
+	if msg, err := stub.GetState("car" + args[0]); err != nil || msg == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found")
+	}
+
+	logbook, err := getLogbookOfCar(stub, carId)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	logbook.Enabled = enabled
+	if err := putLogbook(stub, logbook); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Logbook mode changed", []byte("car: "+args[0]+" logbook: "+args[1]))
+	return Success(http.StatusOK, "OK", []byte("Logbook mode changed"))
+}
+
+//=====================================GET LOGBOOK============================================
+func (cc *CRUD) getLogbook(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path)  -> args[0]: "carId"
+	//(query) -> args[1]: "year"
+
+	carId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven carId cant be converted to an int")
+	}
+	year, err := strconv.Atoi(args[1])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven year cant be converted to an int")
+	}
+
+	logbook, err := getLogbookOfCar(stub, carId)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	//a documented odometer correction between two trips is no gap
+	corrections, err := getOdometerCorrectionsOfCar(stub, carId)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	//return all keys between t and u = all TravelLogs
+	resultsIterator, err := stub.GetStateByRange("t", "u")
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	report := LogbookReport{CarId: carId, Year: year, Enabled: logbook.Enabled, Entries: []TravelLog{}, Corrections: []OdometerCorrection{}, Violations: []LogbookViolation{}}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+
+		var travelLog TravelLog
+		if err := json.Unmarshal(it.Value, &travelLog); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, "travelLog "+it.Key+" is broken")
+		}
+		if travelLog.CarId == carId && strings.HasPrefix(travelLog.StartTime, strconv.Itoa(year)+"-") {
+			report.Entries = append(report.Entries, travelLog)
+		}
+	}
+
+	//the key order is travelLog1, travelLog10, travelLog2 - the logbook wants the order of the trips
+	sort.Slice(report.Entries, func(i, j int) bool { return report.Entries[i].Id < report.Entries[j].Id })
+
+	for _, correction := range corrections {
+		if strings.HasPrefix(correction.Time, strconv.Itoa(year)+"-") {
+			report.Corrections = append(report.Corrections, correction)
+		}
+	}
+
+	for _, travelLog := range report.Entries {
+		violations, err := checkLoggedTrip(stub, travelLog, corrections)
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		report.Violations = append(report.Violations, violations...)
+	}
+
+	reportAsBytes, _ := json.Marshal(report)
+	return Success(http.StatusOK, "OK", reportAsBytes)
+}
+
+//checkLoggedTrip checks a travelLog that is already in the ledger against the rules,
+//its chain to the trip before and its history
+func checkLoggedTrip(stub shim.ChaincodeStubInterface, travelLog TravelLog, corrections []OdometerCorrection) ([]LogbookViolation, error) {
+
+	if travelLog.Hash == "" {
+		return []LogbookViolation{{TravelLogId: travelLog.Id, Rule: ruleIntegrity, Detail: "travelLog was written before the logbook existed and has no hash"}}, nil
+	}
+
+	var prev TravelLog
+	hasPrev := travelLog.PrevLogId != 0
+	if hasPrev {
+		ledgerPrev, err := stub.GetState("travelLog" + strconv.Itoa(travelLog.PrevLogId))
+		if err != nil {
+			return nil, err
+		}
+		if ledgerPrev == nil {
+			return []LogbookViolation{{TravelLogId: travelLog.Id, Rule: ruleIntegrity, Detail: "the trip before (travelLog " + strconv.Itoa(travelLog.PrevLogId) + ") is missing"}}, nil
+		}
+		json.Unmarshal(ledgerPrev, &prev)
+	}
+
+	violations := logbookRuleViolations(travelLog, hasPrev, expectedStartKm(travelLog.PrevLogId, prev.EndKm, corrections))
+
+	if travelLogHash(travelLog) != travelLog.Hash {
+		violations = append(violations, LogbookViolation{TravelLogId: travelLog.Id, Rule: ruleIntegrity, Detail: "hash does not match the content"})
+	}
+	if hasPrev && prev.Hash != travelLog.PrevHash {
+		violations = append(violations, LogbookViolation{TravelLogId: travelLog.Id, Rule: ruleIntegrity, Detail: "hash of the trip before does not match"})
+	}
+
+	//a travelLog is written once - every further write in its history is a modification
+	historyIterator, err := stub.GetHistoryForKey("travelLog" + strconv.Itoa(travelLog.Id))
+	if err != nil {
+		return nil, err
+	}
+	defer historyIterator.Close()
+
+	writes := 0
+	for historyIterator.HasNext() {
+		if _, err := historyIterator.Next(); err != nil {
+			return nil, err
+		}
+		writes += 1
+	}
+	if writes > 1 {
+		violations = append(violations, LogbookViolation{TravelLogId: travelLog.Id, Rule: ruleModified, Detail: "travelLog was written " + strconv.Itoa(writes) + " times"})
+	}
+
+	return violations, nil
+}
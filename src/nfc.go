@@ -0,0 +1,286 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//============================================================================================= NFC
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//the reader of a car asks the ledger for a nonce (requestNfcChallenge), the card signs it and the reader
+//sends the signature with nfcBorrow or nfcReturn - the nonce can be used once and only for a short time
+const nfcChallengeMaxAge = 2 * time.Minute
+
+//what a nonce is for - it cant be used for the other one
+const (
+	nfcActionBorrow = "borrow"
+	nfcActionReturn = "return"
+)
+
+//the NFC card of a user - ledger key "nfcCard1"
+//PublicKey is the base64 DER (PKIX) of the ECDSA P-256 key of the card, the private key never leaves the card
+type NfcCard struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"userId"`
+	PublicKey     string `json:"publicKey"`
+	Registered    string `json:"registered"`
+	RegisteredBy  string `json:"registeredBy"`
+	Revoked       bool   `json:"revoked"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//a nonce of the ledger - ledger key "nfcNonce" + Nonce
+//the nonce comes from the txId, so every peer that endorses requestNfcChallenge makes the same one
+//a used nonce is deleted, so the world state only has the ones that are still open
+type NfcChallenge struct {
+	Nonce         string `json:"nonce"`
+	CarId         int    `json:"carId"`
+	Action        string `json:"action"`
+	Issued        string `json:"issued"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//the payload of the event of nfcBorrow and nfcReturn - which card used which nonce
+//a transaction only has one event, so it is the one of the borrow or the return
+type NfcAuditEvent struct {
+	Nonce   string `json:"nonce"`
+	CarId   int    `json:"carId"`
+	Action  string `json:"action"`
+	CardId  int    `json:"cardId"`
+	UserId  int    `json:"userId"`
+	Message string `json:"message"`
+}
+
+//this one is just for internal Operations in func registerNfcCard
+type CheckNfcCardParameter struct {
+	UserId    int    `json:"userId"`
+	PublicKey string `json:"publicKey"`
+}
+
+//this one is just for internal Operations in func nfcBorrow and nfcReturn
+//Signature is the base64 ASN.1 ECDSA signature of the card over the SHA-256 of nfcSignedMessage
+type CheckNfcParameter struct {
+	CardId    int    `json:"cardId"`
+	Nonce     string `json:"nonce"`
+	Signature string `json:"signature"`
+}
+
+//nfcSignedMessage is what the card signs - the car and the action are in it, so a signature cant be used for another car
+func nfcSignedMessage(action string, carId int, nonce string) []byte {
+	return []byte("slowly-nfc|" + action + "|" + strconv.Itoa(carId) + "|" + nonce)
+}
+
+//parseNfcPublicKey reads the key of a card
+func parseNfcPublicKey(publicKey string) (*ecdsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, errors.New("is no base64")
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.New("is no PKIX public key")
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("has to be an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+//verifyNfcSignature is true if the signature is the one of the key over the message
+func verifyNfcSignature(key *ecdsa.PublicKey, message []byte, signature string) bool {
+	signatureAsBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	var rs struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(signatureAsBytes, &rs); err != nil || len(rest) != 0 {
+		return false
+	}
+	digest := sha256.Sum256(message)
+	return ecdsa.Verify(key, digest[:], rs.R, rs.S)
+}
+
+//checkNfcResponse checks the answer of a card to a nonce and deletes the nonce
+//it returns the card and the nonce - the user of the card is the one who borrows or returns
+func checkNfcResponse(stub shim.ChaincodeStubInterface, action string, carId int, body string) (NfcCard, NfcChallenge, peer.Response, bool) {
+
+	var overgivenParam CheckNfcParameter
+	if response, ok := decodeBody("response", body, &overgivenParam); !ok {
+		return NfcCard{}, NfcChallenge{}, response, false
+	}
+
+	ledgerChallenge, err := stub.GetState("nfcNonce" + overgivenParam.Nonce)
+	if err != nil || ledgerChallenge == nil || overgivenParam.Nonce == "" {
+		return NfcCard{}, NfcChallenge{}, Error(http.StatusForbidden, codeNfcRejected, "the nonce was never issued or was already used", fieldError("nonce", "is unknown")), false
+	}
+	var challenge NfcChallenge
+	json.Unmarshal(ledgerChallenge, &challenge)
+
+	if challenge.CarId != carId || challenge.Action != action {
+		return NfcCard{}, NfcChallenge{}, Error(http.StatusForbidden, codeNfcRejected, "the nonce was issued for another car or action", fieldError("nonce", "is for "+challenge.Action+" of car "+strconv.Itoa(challenge.CarId))), false
+	}
+	issued, err := time.Parse(timeFormat, challenge.Issued)
+	if err != nil || ledgerNow(stub).Sub(issued) > nfcChallengeMaxAge {
+		return NfcCard{}, NfcChallenge{}, Error(http.StatusForbidden, codeNfcRejected, "the nonce expired", fieldError("nonce", "is older than "+nfcChallengeMaxAge.String())), false
+	}
+
+	ledgerCard, err := stub.GetState("nfcCard" + strconv.Itoa(overgivenParam.CardId))
+	if err != nil || ledgerCard == nil {
+		return NfcCard{}, NfcChallenge{}, Error(http.StatusForbidden, codeNfcRejected, "the card is not registered", fieldError("cardId", "is not registered")), false
+	}
+	var card NfcCard
+	json.Unmarshal(ledgerCard, &card)
+	if card.Revoked {
+		return NfcCard{}, NfcChallenge{}, Error(http.StatusForbidden, codeNfcRejected, "the card was revoked", fieldError("cardId", "was revoked")), false
+	}
+
+	key, err := parseNfcPublicKey(card.PublicKey)
+	if err != nil {
+		return NfcCard{}, NfcChallenge{}, Error(http.StatusInternalServerError, codeInternal, "the public key of the card "+err.Error()), false
+	}
+	if !verifyNfcSignature(key, nfcSignedMessage(action, carId, challenge.Nonce), overgivenParam.Signature) {
+		return NfcCard{}, NfcChallenge{}, Error(http.StatusForbidden, codeNfcRejected, "the signature is not the one of the card", fieldError("signature", "does not match the card")), false
+	}
+
+	//a rejected borrow or return is not written at all, so the nonce is only used up by one that works
+	if err := stub.DelState("nfcNonce" + challenge.Nonce); err != nil {
+		return NfcCard{}, NfcChallenge{}, Error(http.StatusInternalServerError, codeInternal, err.Error()), false
+	}
+	return card, challenge, peer.Response{}, true
+}
+
+//setNfcAuditEvent replaces the event of a borrow or return that worked with one that names the card and the nonce
+func setNfcAuditEvent(stub shim.ChaincodeStubInterface, name string, card NfcCard, challenge NfcChallenge, response peer.Response) peer.Response {
+	if response.Status >= 400 {
+		return response
+	}
+	eventAsBytes, _ := json.Marshal(NfcAuditEvent{
+		Nonce:   challenge.Nonce,
+		CarId:   challenge.CarId,
+		Action:  challenge.Action,
+		CardId:  card.Id,
+		UserId:  card.UserId,
+		Message: string(response.Payload),
+	})
+	stub.SetEvent(name, eventAsBytes)
+	return response
+}
+
+//=====================================REGISTER NFC CARD======================================
+func (cc *CRUD) registerNfcCard(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "cardId"
+	//(body) -> args[1]: {"userId":3,"publicKey":"MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE..."}
+
+	cardId, err := strconv.Atoi(args[0])
+	if err != nil || cardId <= 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "the cardId has to be greater than 0", fieldError("cardId", "has to be greater than 0"))
+	}
+	if obj, err := stub.GetState("nfcCard" + args[0]); err != nil || obj != nil {
+		return Error(http.StatusConflict, codeNfcCardAlreadyExists, "a card with this id already exists")
+	}
+
+	var overgivenParam CheckNfcCardParameter
+	if response, ok := decodeBody("card", args[1], &overgivenParam); !ok {
+		return response
+	}
+	overgivenParam.PublicKey = strings.TrimSpace(overgivenParam.PublicKey)
+	if _, err := parseNfcPublicKey(overgivenParam.PublicKey); err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "publicKey "+err.Error(), fieldError("publicKey", err.Error()))
+	}
+
+	ledgerUser, err := stub.GetState("user" + strconv.Itoa(overgivenParam.UserId))
+	if err != nil || ledgerUser == nil {
+		return Error(http.StatusNotFound, codeUserNotFound, "User Not Found - wrong overgiven userId!")
+	}
+
+	card := NfcCard{
+		Id:           cardId,
+		UserId:       overgivenParam.UserId,
+		PublicKey:    overgivenParam.PublicKey,
+		Registered:   ledgerNow(stub).Format(timeFormat),
+		RegisteredBy: callerId(stub),
+	}
+	cardAsBytes, _ := json.Marshal(card)
+	if err := stub.PutState("nfcCard"+args[0], cardAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("NFC card registered", []byte("card: "+args[0]))
+	return Success(http.StatusCreated, "Created", cardAsBytes)
+}
+
+//=====================================REVOKE NFC CARD========================================
+func (cc *CRUD) revokeNfcCard(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "cardId" - a lost card, it stays in the ledger for the nonces it used
+
+	ledgerCard, err := stub.GetState("nfcCard" + args[0])
+	if err != nil || ledgerCard == nil {
+		return Error(http.StatusNotFound, codeNfcCardNotFound, "NFC Card Not Found")
+	}
+	var card NfcCard
+	json.Unmarshal(ledgerCard, &card)
+
+	card.Revoked = true
+	cardAsBytes, _ := json.Marshal(card)
+	if err := stub.PutState("nfcCard"+args[0], cardAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("NFC card revoked", []byte("card: "+args[0]))
+	return Success(http.StatusOK, "OK", cardAsBytes)
+}
+
+//=====================================REQUEST NFC CHALLENGE==================================
+func (cc *CRUD) requestNfcChallenge(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId"
+	//(query) -> args[1]: "borrow" or "return"
+	//this has to be invoked (not queried), the nonce has to be in the ledger before the card answers
+	if args[1] != nfcActionBorrow && args[1] != nfcActionReturn {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "the action has to be borrow or return", fieldError("action", "has to be borrow or return"))
+	}
+
+	carId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "Cant Atoi args[0] ")
+	}
+	if ledgerCar, err := stub.GetState("car" + args[0]); err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found")
+	}
+
+	digest := sha256.Sum256([]byte(stub.GetTxID() + "|" + args[0] + "|" + args[1]))
+	challenge := NfcChallenge{
+		Nonce:  hex.EncodeToString(digest[:]),
+		CarId:  carId,
+		Action: args[1],
+		Issued: ledgerNow(stub).Format(timeFormat),
+	}
+	challengeAsBytes, _ := json.Marshal(challenge)
+	if err := stub.PutState("nfcNonce"+challenge.Nonce, challengeAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	return Success(http.StatusCreated, "Created", challengeAsBytes)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const testNfcNonce = "4e6f6e6365"
+
+//signNfc signs like the card does
+func signNfc(t *testing.T, key *ecdsa.PrivateKey, message []byte) string {
+	digest := sha256.Sum256(message)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, _ := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+//newNfcStub has card 1 of user 1 and an open nonce to borrow car 1
+func newNfcStub(t *testing.T) (*shim.MockStub, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	stub := shim.NewMockStub("slowly", new(CRUD))
+	stub.MockTransactionStart("setup")
+	cardAsBytes, _ := json.Marshal(NfcCard{Id: 1, UserId: 1, PublicKey: base64.StdEncoding.EncodeToString(der)})
+	stub.PutState("nfcCard1", cardAsBytes)
+	challengeAsBytes, _ := json.Marshal(NfcChallenge{Nonce: testNfcNonce, CarId: 1, Action: nfcActionBorrow, Issued: ledgerNow(stub).Format(timeFormat)})
+	stub.PutState("nfcNonce"+testNfcNonce, challengeAsBytes)
+	stub.MockTransactionEnd("setup")
+	return stub, key
+}
+
+//nfcResponse is the body the reader sends for a card
+func nfcResponse(t *testing.T, key *ecdsa.PrivateKey, action string, carId int) string {
+	body, _ := json.Marshal(CheckNfcParameter{CardId: 1, Nonce: testNfcNonce, Signature: signNfc(t, key, nfcSignedMessage(action, carId, testNfcNonce))})
+	return string(body)
+}
+
+func TestVerifyNfcSignature(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	message := nfcSignedMessage(nfcActionBorrow, 1, testNfcNonce)
+	signature := signNfc(t, key, message)
+
+	if !verifyNfcSignature(&key.PublicKey, message, signature) {
+		t.Error("the signature of the card was rejected")
+	}
+	if verifyNfcSignature(&key.PublicKey, nfcSignedMessage(nfcActionBorrow, 2, testNfcNonce), signature) {
+		t.Error("the signature was accepted for another car")
+	}
+	if verifyNfcSignature(&key.PublicKey, nfcSignedMessage(nfcActionReturn, 1, testNfcNonce), signature) {
+		t.Error("the signature was accepted for another action")
+	}
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if verifyNfcSignature(&otherKey.PublicKey, message, signature) {
+		t.Error("the signature was accepted for another card")
+	}
+	if verifyNfcSignature(&key.PublicKey, message, "no base64") {
+		t.Error("a signature that is no base64 was accepted")
+	}
+}
+
+func TestCheckNfcResponse(t *testing.T) {
+	stub, key := newNfcStub(t)
+
+	stub.MockTransactionStart("borrow")
+	card, challenge, response, ok := checkNfcResponse(stub, nfcActionBorrow, 1, nfcResponse(t, key, nfcActionBorrow, 1))
+	stub.MockTransactionEnd("borrow")
+	if !ok {
+		t.Fatalf("a valid response was rejected: %s", response.Message)
+	}
+	if card.UserId != 1 || challenge.Nonce != testNfcNonce {
+		t.Errorf("got card %+v and nonce %+v", card, challenge)
+	}
+	if nonce, _ := stub.GetState("nfcNonce" + testNfcNonce); nonce != nil {
+		t.Error("the used nonce was not deleted")
+	}
+}
+
+func TestCheckNfcResponseWrongCar(t *testing.T) {
+	stub, key := newNfcStub(t)
+
+	stub.MockTransactionStart("borrow")
+	_, _, response, ok := checkNfcResponse(stub, nfcActionBorrow, 2, nfcResponse(t, key, nfcActionBorrow, 2))
+	stub.MockTransactionEnd("borrow")
+	if ok || response.Status != http.StatusForbidden {
+		t.Fatalf("the nonce of car 1 was accepted for car 2: %d %s", response.Status, response.Message)
+	}
+	if nonce, _ := stub.GetState("nfcNonce" + testNfcNonce); nonce == nil {
+		t.Error("a rejected response used up the nonce")
+	}
+}
+
+func TestCheckNfcResponseReplay(t *testing.T) {
+	stub, key := newNfcStub(t)
+	body := nfcResponse(t, key, nfcActionBorrow, 1)
+
+	stub.MockTransactionStart("borrow")
+	if _, _, response, ok := checkNfcResponse(stub, nfcActionBorrow, 1, body); !ok {
+		t.Fatalf("a valid response was rejected: %s", response.Message)
+	}
+	stub.MockTransactionEnd("borrow")
+
+	stub.MockTransactionStart("replay")
+	_, _, response, ok := checkNfcResponse(stub, nfcActionBorrow, 1, body)
+	stub.MockTransactionEnd("replay")
+	if ok || response.Status != http.StatusForbidden {
+		t.Fatalf("a recorded response was accepted again: %d %s", response.Status, response.Message)
+	}
+}
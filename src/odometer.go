@@ -0,0 +1,364 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//======================================================================================== ODOMETER
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//the rules every overgiven newKm has to pass - ledger key "configOdometer"
+//TelemetryMismatch is "off", "flag" or "reject" - what happens if newKm and the telematics box differ by more than TelemetryToleranceKm
+type OdometerRules struct {
+	MaxTripKm            int    `json:"maxTripKm"`
+	MaxAvgSpeed          int    `json:"maxAvgSpeed"`
+	TelemetryToleranceKm int    `json:"telemetryToleranceKm"`
+	TelemetryMismatch    string `json:"telemetryMismatch"`
+	SchemaVersion        int    `json:"schemaVersion"`
+}
+
+//used as long as no admin has set other rules - rules set before the telemetry keep its defaults
+var defaultOdometerRules = OdometerRules{MaxTripKm: 2000, MaxAvgSpeed: 200, TelemetryToleranceKm: 10, TelemetryMismatch: telemetryMismatchFlag}
+
+//a shorter trip is checked as if it took this long - the times only have seconds, so the speed
+//of a short trip cant be told exactly, but a trip of seconds may still not have hundreds of km
+const minTripDuration = time.Minute
+
+//what kind of change an OdometerCorrection is
+const (
+	kindCorrection  = "correction"
+	kindReplacement = "replacement"
+)
+
+//every change of the km of a car outside of a trip - ledger key "odoCorrection1"
+//AfterLogId is the last travelLog of the car when the correction was made
+type OdometerCorrection struct {
+	Id            int    `json:"id"`
+	CarId         int    `json:"carId"`
+	Kind          string `json:"kind"`
+	OldKm         int    `json:"oldKm"`
+	NewKm         int    `json:"newKm"`
+	AfterLogId    int    `json:"afterLogId"`
+	Reason        string `json:"reason"`
+	By            string `json:"by"`
+	Time          string `json:"time"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//one per car with a replaced odometer - ledger key "odoOffset1"
+//the km of the car + Offset = the km the car really has driven since it was new
+type OdometerOffset struct {
+	CarId         int `json:"carId"`
+	Offset        int `json:"offset"`
+	Replacements  int `json:"replacements"`
+	SchemaVersion int `json:"schemaVersion"`
+}
+
+//this one is just for internal Operations in func recordOdometerReplacement
+type CheckOdometerReplacementParameter struct {
+	NewKm  int    `json:"newKm"`
+	Reason string `json:"reason"`
+}
+
+//this one is just the answer of getCarOdometer
+type CarOdometer struct {
+	CarId        int                  `json:"carId"`
+	Km           int                  `json:"km"`
+	Offset       int                  `json:"offset"`
+	CumulativeKm int                  `json:"cumulativeKm"`
+	Corrections  []OdometerCorrection `json:"corrections"`
+}
+
+func readOdometerRules(stub shim.ChaincodeStubInterface) (OdometerRules, error) {
+
+	rules := defaultOdometerRules
+	ledgerRules, err := stub.GetState("configOdometer")
+	if err != nil {
+		return rules, err
+	}
+	if ledgerRules != nil {
+		err = json.Unmarshal(ledgerRules, &rules)
+	}
+	return rules, err
+}
+
+//checkOdometerPlausibility returns why the km of a trip cant be true or "" if they can
+func checkOdometerPlausibility(rules OdometerRules, startKm int, endKm int, startTime string, endTime string) string {
+
+	drivenKm := endKm - startKm
+	if drivenKm > rules.MaxTripKm {
+		return "a trip of " + strconv.Itoa(drivenKm) + " km is more than the allowed " + strconv.Itoa(rules.MaxTripKm) + " km"
+	}
+
+	start, errStart := time.Parse(timeFormat, startTime)
+	end, errEnd := time.Parse(timeFormat, endTime)
+	if errStart != nil || errEnd != nil {
+		return "the duration of the trip cant be calculated"
+	}
+
+	duration := end.Sub(start)
+	checked := duration
+	if checked < minTripDuration {
+		checked = minTripDuration
+	}
+	if float64(drivenKm) > float64(rules.MaxAvgSpeed)*checked.Hours() {
+		return strconv.Itoa(drivenKm) + " km in " + duration.String() + " is faster than the allowed average of " + strconv.Itoa(rules.MaxAvgSpeed) + " km/h"
+	}
+	return ""
+}
+
+//recordOdometerCorrection writes the correction to the ledger and lets the logbook of the car continue at newKm
+func recordOdometerCorrection(stub shim.ChaincodeStubInterface, logbook *Logbook, kind string, oldKm int, newKm int, reason string) error {
+
+	obj, _ := stub.GetState("counterO")
+	counter, _ := strconv.Atoi(string(obj))
+	counter += 1
+
+	correction := OdometerCorrection{
+		Id:         counter,
+		CarId:      logbook.CarId,
+		Kind:       kind,
+		OldKm:      oldKm,
+		NewKm:      newKm,
+		AfterLogId: logbook.LastLogId,
+		Reason:     reason,
+		By:         callerId(stub),
+		Time:       ledgerNow(stub).Format(timeFormat),
+	}
+
+	correctionAsBytes, _ := json.Marshal(correction)
+	if err := stub.PutState("odoCorrection"+strconv.Itoa(counter), correctionAsBytes); err != nil {
+		return err
+	}
+	if err := stub.PutState("counterO", []byte(strconv.Itoa(counter))); err != nil {
+		return err
+	}
+
+	logbook.LastEndKm = newKm
+	return putLogbook(stub, *logbook)
+}
+
+//getOdometerOffsetOfCar reads the offset of a car - a car with its first odometer has the offset 0
+func getOdometerOffsetOfCar(stub shim.ChaincodeStubInterface, carId int) (OdometerOffset, error) {
+
+	offset := OdometerOffset{CarId: carId}
+	ledgerOffset, err := stub.GetState("odoOffset" + strconv.Itoa(carId))
+	if err != nil {
+		return offset, err
+	}
+	if ledgerOffset != nil {
+		err = json.Unmarshal(ledgerOffset, &offset)
+	}
+	return offset, err
+}
+
+//getOdometerCorrectionsOfCar returns all corrections of a car in the order they were made
+func getOdometerCorrectionsOfCar(stub shim.ChaincodeStubInterface, carId int) ([]OdometerCorrection, error) {
+
+	corrections := []OdometerCorrection{}
+
+	resultsIterator, err := stub.GetStateByRange("odoCorrection", "odoCorrectioo")
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var correction OdometerCorrection
+		if err := json.Unmarshal(it.Value, &correction); err != nil {
+			return nil, err
+		}
+		if correction.CarId == carId {
+			corrections = append(corrections, correction)
+		}
+	}
+
+	//the key order is odoCorrection1, odoCorrection10, odoCorrection2
+	sort.Slice(corrections, func(i, j int) bool { return corrections[i].Id < corrections[j].Id })
+	return corrections, nil
+}
+
+//expectedStartKm is where the trip after travelLog prevLogId has to start - its endKm moved by every correction in between
+func expectedStartKm(prevLogId int, prevEndKm int, corrections []OdometerCorrection) int {
+	expected := prevEndKm
+	for _, correction := range corrections {
+		if correction.AfterLogId == prevLogId {
+			expected = correction.NewKm
+		}
+	}
+	return expected
+}
+
+//=====================================GET ODOMETER RULES=====================================
+func (cc *CRUD) getOdometerRules(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+
+	rules, err := readOdometerRules(stub)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	rulesAsBytes, _ := json.Marshal(rules)
+	return Success(http.StatusOK, "OK", rulesAsBytes)
+}
+
+//=====================================SET ODOMETER RULES=====================================
+func (cc *CRUD) setOdometerRules(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(body) -> args[0]: {"maxTripKm":2000,"maxAvgSpeed":200,"telemetryToleranceKm":10,"telemetryMismatch":"flag"}
+	//the telemetry fields can be left out, then they are the defaults
+
+	rules := OdometerRules{TelemetryToleranceKm: defaultOdometerRules.TelemetryToleranceKm, TelemetryMismatch: defaultOdometerRules.TelemetryMismatch}
+	if response, ok := decodeBody("rules", args[0], documentFields(&rules)); !ok {
+		return response
+	}
+	if rules.MaxTripKm <= 0 || rules.MaxAvgSpeed <= 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "maxTripKm and maxAvgSpeed must be greater than 0")
+	}
+	if rules.TelemetryToleranceKm < 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "telemetryToleranceKm cant be negative", fieldError("telemetryToleranceKm", "cant be negative"))
+	}
+	switch rules.TelemetryMismatch {
+	case telemetryMismatchOff, telemetryMismatchFlag, telemetryMismatchReject:
+	default:
+		return Error(http.StatusBadRequest, codeInvalidParameter, "telemetryMismatch has to be off, flag or reject", fieldError("telemetryMismatch", "has to be off, flag or reject"))
+	}
+
+	rulesAsBytes, _ := json.Marshal(rules)
+	if err := stub.PutState("configOdometer", rulesAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Odometer rules changed", rulesAsBytes)
+	return Success(http.StatusOK, "OK", []byte("Odometer rules changed"))
+}
+
+//=====================================GET ODOMETER CORRECTIONS===============================
+func (cc *CRUD) getOdometerCorrections(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+
+	carId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven carId cant be converted to an int")
+	}
+
+	corrections, err := getOdometerCorrectionsOfCar(stub, carId)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	correctionsAsBytes, _ := json.Marshal(corrections)
+	return Success(http.StatusOK, "OK", correctionsAsBytes)
+}
+
+//=====================================RECORD ODOMETER REPLACEMENT============================
+func (cc *CRUD) recordOdometerReplacement(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId"
+	//(body) -> args[1]: {"newKm":12,"reason":"instrument cluster replaced"}
+
+	ledgerCar, err := stub.GetState("car" + args[0])
+	if err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found")
+	}
+	var car Car
+	json.Unmarshal(ledgerCar, &car)
+
+	if car.BorrowId != 0 {
+		return Error(http.StatusConflict, codeCarAlreadyBorrowed, "the odometer of a borrowed car cant be replaced")
+	}
+
+	var overgivenParam CheckOdometerReplacementParameter
+	if response, ok := decodeBody("replacement", args[1], &overgivenParam); !ok {
+		return response
+	}
+	details := []FieldError{}
+	if overgivenParam.NewKm < 0 {
+		details = append(details, fieldError("newKm", "cant be negative"))
+	}
+	if overgivenParam.Reason == "" {
+		details = append(details, fieldError("reason", "cant be empty"))
+	}
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "Overgiven paramters are wrong!", details...)
+	}
+	//a negative offset would take km away from the car - the new odometer cant show more than the old one
+	if overgivenParam.NewKm > car.Km {
+		return Error(http.StatusBadRequest, codeInvalidKm, "the new odometer cant show more km than the old one", fieldError("newKm", "is more than the "+strconv.Itoa(car.Km)+" km of the old odometer"))
+	}
+
+	//the km the old odometer showed are kept in the offset
+	offset, err := getOdometerOffsetOfCar(stub, car.Id)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	offset.Offset += car.Km - overgivenParam.NewKm
+	offset.Replacements += 1
+
+	offsetAsBytes, _ := json.Marshal(offset)
+	if err := stub.PutState("odoOffset"+strconv.Itoa(car.Id), offsetAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, "update odometer offset failed")
+	}
+
+	logbook, err := getLogbookOfCar(stub, car.Id)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if err := recordOdometerCorrection(stub, &logbook, kindReplacement, car.Km, overgivenParam.NewKm, overgivenParam.Reason); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, "create odometer correction failed")
+	}
+
+	//from now on the car has the km of the new odometer
+	car.Km = overgivenParam.NewKm
+	carAsBytes, _ := json.Marshal(car)
+	if err := stub.PutState("car"+strconv.Itoa(car.Id), carAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, "Update car failed")
+	}
+
+	stub.SetEvent("Odometer replaced", []byte("car: "+args[0]+" offset: "+strconv.Itoa(offset.Offset)))
+	return Success(http.StatusOK, "OK", offsetAsBytes)
+}
+
+//=====================================GET CAR ODOMETER=======================================
+func (cc *CRUD) getCarOdometer(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+
+	ledgerCar, err := stub.GetState("car" + args[0])
+	if err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found")
+	}
+	var car Car
+	json.Unmarshal(ledgerCar, &car)
+
+	offset, err := getOdometerOffsetOfCar(stub, car.Id)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	corrections, err := getOdometerCorrectionsOfCar(stub, car.Id)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	odometer := CarOdometer{
+		CarId:        car.Id,
+		Km:           car.Km,
+		Offset:       offset.Offset,
+		CumulativeKm: car.Km + offset.Offset,
+		Corrections:  corrections,
+	}
+
+	odometerAsBytes, _ := json.Marshal(odometer)
+	return Success(http.StatusOK, "OK", odometerAsBytes)
+}
@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestCheckOdometerPlausibilityShortTrip(t *testing.T) {
+	start := "2026-10-19 10:00:00"
+
+	if problem := checkOdometerPlausibility(defaultOdometerRules, 1000, 1500, start, "2026-10-19 10:00:30"); problem == "" {
+		t.Error("500 km in 30s were accepted")
+	}
+	if problem := checkOdometerPlausibility(defaultOdometerRules, 1000, 1500, start, start); problem == "" {
+		t.Error("500 km in no time were accepted")
+	}
+	if problem := checkOdometerPlausibility(defaultOdometerRules, 1000, 1002, start, "2026-10-19 10:00:30"); problem != "" {
+		t.Errorf("2 km in 30s were rejected: %s", problem)
+	}
+}
@@ -0,0 +1,321 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//========================================================================================= OPENAPI
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//the OpenAPI document is made from the registry and the go types, so it cant drift from the chaincode
+//the SAP service only takes swagger 2 - slowly.yaml is written from swaggerDocument by "go test -run TestSlowlyYaml -update"
+const openAPIVersion = "3.0.3"
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+//schema is one JSON schema of the document - a map, so json.Marshal writes the keys sorted and every peer the same bytes
+type schema map[string]interface{}
+
+func refSchema(name string) schema {
+	return schema{"$ref": "#/components/schemas/" + name}
+}
+
+//openAPISchemas builds the schemas of the components out of the go types
+type openAPISchemas map[string]schema
+
+//schemaOfType is the schema of a go type, a struct is added to the components and referenced
+func (schemas openAPISchemas) schemaOfType(t reflect.Type) schema {
+	if t == rawMessageType {
+		return schema{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemas.schemaOfType(t.Elem())
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int32:
+		return schema{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return schema{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return schema{"type": "array", "items": schemas.schemaOfType(t.Elem())}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": schemas.schemaOfType(t.Elem())}
+	case reflect.Struct:
+		schemas.addStruct(t)
+		return refSchema(t.Name())
+	}
+	return schema{}
+}
+
+//addStruct adds a struct with the json names of its exported fields
+//schemaVersion is set by the chaincode on every write, so a client never has to send it
+func (schemas openAPISchemas) addStruct(t reflect.Type) {
+	if _, found := schemas[t.Name()]; found {
+		return
+	}
+	properties := schema{}
+	object := schema{"type": "object", "properties": properties}
+	schemas[t.Name()] = object
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := schemas.schemaOfType(field.Type)
+		if name == "schemaVersion" {
+			property["readOnly"] = true
+		}
+		properties[name] = property
+	}
+}
+
+//successOf is the schema of a successful answer - every answer is an Envelope, the data has the go type of the result of the function
+func (schemas openAPISchemas) successOf(spec FunctionSpec) schema {
+	if spec.result == nil {
+		return refSchema("Envelope")
+	}
+	return schema{"allOf": []schema{
+		refSchema("Envelope"),
+		{"type": "object", "properties": schema{"data": schemas.schemaOfType(reflect.TypeOf(spec.result))}},
+	}}
+}
+
+//schemaOfArg is the schema of a path, query or body argument
+func (schemas openAPISchemas) schemaOfArg(arg ArgSpec) schema {
+	switch arg.Type {
+	case argInteger:
+		return schema{"type": "integer", "format": "int32"}
+	case argNumber:
+		return schema{"type": "number"}
+	case argBoolean:
+		return schema{"type": "boolean"}
+	case argJSON:
+		if arg.Schema == nil {
+			return schema{}
+		}
+		var body schema
+		if arg.Schema.Type == "array" {
+			body = schema{"type": "array", "items": schemas.schemaOfArg(ArgSpec{Type: arg.Schema.Items})}
+		} else {
+			body = schema{"allOf": []schema{schemas.schemaOfType(arg.Schema.modelType)}}
+			if len(arg.Schema.Required) != 0 {
+				body["required"] = arg.Schema.Required
+			}
+		}
+		return body
+	}
+	return schema{"type": "string"}
+}
+
+//operationOf is the OpenAPI operation of one function of the registry
+func (schemas openAPISchemas) operationOf(spec FunctionSpec) schema {
+	parameters := []schema{}
+	var requestBody schema
+	for _, arg := range spec.Args {
+		if arg.In == inBody {
+			mediaType := "text/plain"
+			if arg.Type == argJSON {
+				mediaType = "application/json"
+			}
+			requestBody = schema{
+				"required":    !arg.Optional,
+				"description": arg.Name,
+				"content":     schema{mediaType: schema{"schema": schemas.schemaOfArg(arg)}},
+			}
+			continue
+		}
+		parameters = append(parameters, schema{
+			"name":     arg.Name,
+			"in":       arg.In,
+			"required": arg.In == inPath || !arg.Optional,
+			"schema":   schemas.schemaOfArg(arg),
+		})
+	}
+
+	responses := schema{
+		"2XX":     schema{"description": "OK", "content": schema{"application/json": schema{"schema": schemas.successOf(spec)}}},
+		"default": schema{"description": "an error, see code and details", "content": schema{"application/json": schema{"schema": refSchema("Envelope")}}},
+	}
+
+	summary := spec.Description
+	if spec.Role != roleAnyone {
+		summary += " (" + spec.Role + " only)"
+	}
+	operation := schema{
+		"operationId": spec.Name,
+		"summary":     summary,
+		"parameters":  parameters,
+		"responses":   responses,
+		"x-role":      spec.Role,
+		"x-query":     spec.Query,
+	}
+	if requestBody != nil {
+		operation["requestBody"] = requestBody
+	}
+	return operation
+}
+
+//openAPIDocument is the whole document of every function of the registry
+func openAPIDocument() schema {
+	schemas := openAPISchemas{}
+	schemas.schemaOfType(reflect.TypeOf(Envelope{}))
+
+	paths := schema{}
+	for _, spec := range functionRegistry {
+		path, found := paths[spec.Path].(schema)
+		if !found {
+			path = schema{}
+			paths[spec.Path] = path
+		}
+		path[spec.Method] = schemas.operationOf(spec)
+	}
+
+	components := schema{}
+	for name, object := range schemas {
+		components[name] = object
+	}
+
+	return schema{
+		"openapi": openAPIVersion,
+		"info": schema{
+			"title":       "Test Fuhrpark",
+			"version":     "1.0",
+			"description": "Lets play with cars and users - made by the chaincode from its function registry",
+		},
+		"paths":      paths,
+		"components": schema{"schemas": components},
+	}
+}
+
+//swaggerOperationOf is the swagger 2 operation of one function of the registry
+//a JSON argument in the path or the query is just a string there
+func (schemas openAPISchemas) swaggerOperationOf(spec FunctionSpec) schema {
+	parameters := []schema{}
+	consumes := []string{"application/json"}
+	for _, arg := range spec.Args {
+		parameter := schema{
+			"name":     arg.Name,
+			"in":       arg.In,
+			"required": arg.In == inPath || !arg.Optional,
+		}
+		switch {
+		case arg.In == inBody:
+			if arg.Type != argJSON {
+				consumes = []string{"text/plain"}
+			}
+			parameter["schema"] = schemas.schemaOfArg(arg)
+		case arg.Type == argJSON:
+			parameter["type"] = "string"
+			parameter["description"] = "JSON"
+		default:
+			for key, value := range schemas.schemaOfArg(arg) {
+				parameter[key] = value
+			}
+		}
+		parameters = append(parameters, parameter)
+	}
+
+	summary := spec.Description
+	if spec.Role != roleAnyone {
+		summary += " (" + spec.Role + " only)"
+	}
+	return schema{
+		"operationId": spec.Name,
+		"summary":     summary,
+		"consumes":    consumes,
+		"parameters":  parameters,
+		"responses": schema{
+			"200":     schema{"description": "OK", "schema": schemas.successOf(spec)},
+			"default": schema{"description": "an error, see code and details", "schema": refSchema("Envelope")},
+		},
+		"x-role":  spec.Role,
+		"x-query": spec.Query,
+	}
+}
+
+//swaggerRefs points the references of the OpenAPI 3 components to the swagger 2 definitions
+func swaggerRefs(value interface{}) {
+	switch v := value.(type) {
+	case schema:
+		for key, entry := range v {
+			if ref, ok := entry.(string); ok && key == "$ref" {
+				v[key] = "#/definitions/" + strings.TrimPrefix(ref, "#/components/schemas/")
+				continue
+			}
+			swaggerRefs(entry)
+		}
+	case []schema:
+		for _, entry := range v {
+			swaggerRefs(entry)
+		}
+	}
+}
+
+//swaggerDocument is the swagger 2 document of every function of the registry, the one of slowly.yaml
+func swaggerDocument() schema {
+	schemas := openAPISchemas{}
+	schemas.schemaOfType(reflect.TypeOf(Envelope{}))
+
+	paths := schema{}
+	for _, spec := range functionRegistry {
+		path, found := paths[spec.Path].(schema)
+		if !found {
+			path = schema{}
+			paths[spec.Path] = path
+		}
+		path[spec.Method] = schemas.swaggerOperationOf(spec)
+	}
+
+	definitions := schema{}
+	for name, object := range schemas {
+		definitions[name] = object
+	}
+
+	document := schema{
+		"swagger": "2.0",
+		"info": schema{
+			"title":       "Test Fuhrpark",
+			"version":     "1.0",
+			"description": "Lets play with cars and users. Every answer is wrapped in an Envelope - a client checks the code and not the message",
+		},
+		"produces":    []string{"application/json"},
+		"paths":       paths,
+		"definitions": definitions,
+	}
+	swaggerRefs(document)
+	return document
+}
+
+//=====================================GET OPENAPI============================================
+func (cc *CRUD) getOpenAPI(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+
+	documentAsBytes, err := json.Marshal(openAPIDocument())
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	return Success(http.StatusOK, "OK", documentAsBytes)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var updateSwagger = flag.Bool("update", false, "write slowly.yaml from the function registry")
+
+const slowlyYamlHeader = "# written by \"go test -run TestSlowlyYaml -update\" from the function registry - dont edit it by hand\n"
+
+//a key that is no plain word is quoted, so "200" stays a string and "/cars/{id}" can be read
+var plainYamlKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+//yamlScalar is a JSON scalar - a JSON string is a YAML string as well
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	var quoted bytes.Buffer
+	encoder := json.NewEncoder(&quoted)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return strings.TrimSuffix(quoted.String(), "\n")
+}
+
+func yamlKey(key string) string {
+	if plainYamlKey.MatchString(key) {
+		return key
+	}
+	return yamlScalar(key)
+}
+
+//writeYaml writes a decoded JSON document as block YAML with sorted keys
+func writeYaml(out *strings.Builder, value interface{}, indent string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			out.WriteString(indent + yamlKey(key) + ":")
+			writeYamlValue(out, v[key], indent+"  ")
+		}
+	case []interface{}:
+		for _, entry := range v {
+			var item strings.Builder
+			writeYamlValue(&item, entry, indent+"  ")
+			text := item.String()
+			if strings.HasPrefix(text, "\n"+indent+"  ") {
+				//the first key of an object goes on the line of its dash
+				text = " " + strings.TrimPrefix(text, "\n"+indent+"  ")
+			}
+			out.WriteString(indent + "-" + text)
+		}
+	}
+}
+
+func writeYamlValue(out *strings.Builder, value interface{}, indent string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			out.WriteString(" {}\n")
+			return
+		}
+		out.WriteString("\n")
+		writeYaml(out, v, indent)
+	case []interface{}:
+		if len(v) == 0 {
+			out.WriteString(" []\n")
+			return
+		}
+		out.WriteString("\n")
+		writeYaml(out, v, indent)
+	default:
+		out.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+func slowlyYaml(t *testing.T) string {
+	documentAsBytes, err := json.Marshal(swaggerDocument())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document interface{}
+	json.Unmarshal(documentAsBytes, &document)
+
+	var out strings.Builder
+	out.WriteString(slowlyYamlHeader)
+	writeYaml(&out, document, "")
+	return out.String()
+}
+
+func TestSlowlyYaml(t *testing.T) {
+	generated := slowlyYaml(t)
+	if *updateSwagger {
+		if err := ioutil.WriteFile("slowly.yaml", []byte(generated), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	written, err := ioutil.ReadFile("slowly.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != generated {
+		t.Error("slowly.yaml is not the one of the function registry - run go test -run TestSlowlyYaml -update")
+	}
+}
+
+func TestOpenAPIModelsOfRegistry(t *testing.T) {
+	document := openAPIDocument()
+	components := document["components"].(schema)["schemas"].(schema)
+	for _, spec := range functionRegistry {
+		for _, arg := range spec.Args {
+			if arg.Schema != nil && arg.Schema.Model != "" {
+				if _, found := components[arg.Schema.Model]; !found {
+					t.Errorf("%s: the body %s has no schema %s", spec.Name, arg.Name, arg.Schema.Model)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//============================================================================ PERSONAL DATA (PII)
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//the private data collection of collections_config.json - only the member orgs of it store the personal data
+const collectionUserPII = "collectionUserPII"
+
+//the key of the transient map the personal data of a user is overgiven with
+//it is not part of the proposal, so it never ends up in a block
+const transientUserPII = "user"
+
+//the salt is chosen by the client, it has to be long enough so the name cant be guessed from the hash
+const minSaltLength = 16
+
+//the key of the transient map with the secret the salts of Init and migrateRecords are made from
+//a salt from something public like the txId would let everybody guess the names from the hashes
+const transientSalt = "salt"
+
+//this one is written to the private data collection - key "user1" in collectionUserPII
+//the public User only has the pseudonym and the salted hash of the name
+type UserPII struct {
+	Id            int    `json:"id"`
+	Name          string `json:"name"`
+	Salt          string `json:"salt"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//this one is just for internal Operations - the value of the transient key "user"
+//{"name":"Alice","salt":"8c1f0e4b2a7d93e6"} - the salt can be left out on an update
+type CheckUserPIIParameter struct {
+	Name string `json:"name"`
+	Salt string `json:"salt,omitempty"`
+}
+
+//saltedHash is hex(sha256(salt|value))
+func saltedHash(salt string, value string) string {
+	sum := sha256.Sum256([]byte(salt + "|" + value))
+	return hex.EncodeToString(sum[:])
+}
+
+//pseudonymOf is the public id of a user that cant be linked to his name without the salt
+func pseudonymOf(salt string, userId int) string {
+	return "p" + saltedHash(salt, "user"+strconv.Itoa(userId))[:16]
+}
+
+//readTransientUserPII returns the personal data of the transient map - found is false if there is none
+func readTransientUserPII(stub shim.ChaincodeStubInterface) (CheckUserPIIParameter, bool, error) {
+
+	var overgivenPII CheckUserPIIParameter
+
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return overgivenPII, false, err
+	}
+	value, found := transient[transientUserPII]
+	if !found {
+		return overgivenPII, false, nil
+	}
+
+	if err := json.Unmarshal(value, &overgivenPII); err != nil {
+		return overgivenPII, true, errors.New("Unmarshalling the personal data of the transient map failed")
+	}
+	if overgivenPII.Name == "" {
+		return overgivenPII, true, errors.New("the personal data of the transient map has no name")
+	}
+	if overgivenPII.Salt != "" && len(overgivenPII.Salt) < minSaltLength {
+		return overgivenPII, true, errors.New("the salt has to be at least " + strconv.Itoa(minSaltLength) + " characters long")
+	}
+	return overgivenPII, true, nil
+}
+
+//readTransientSalt is the secret of the transient map the salts of users without their own one are made from
+func readTransientSalt(stub shim.ChaincodeStubInterface) (string, peer.Response, bool) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return "", Error(http.StatusInternalServerError, codeInternal, err.Error()), false
+	}
+	secret := string(transient[transientSalt])
+	if len(secret) < minSaltLength {
+		return "", Error(http.StatusBadRequest, codeInvalidPersonalData, "the transient map needs the key "+transientSalt+" with at least "+strconv.Itoa(minSaltLength)+" characters", fieldError(transientSalt, "is missing or too short")), false
+	}
+	return secret, peer.Response{}, true
+}
+
+//getUserPIIOfUser reads the private personal data of a user - nil if there is none
+func getUserPIIOfUser(stub shim.ChaincodeStubInterface, userId int) (*UserPII, error) {
+
+	ledgerPII, err := stub.GetPrivateData(collectionUserPII, "user"+strconv.Itoa(userId))
+	if err != nil || ledgerPII == nil {
+		return nil, err
+	}
+
+	var pii UserPII
+	if err := json.Unmarshal(ledgerPII, &pii); err != nil {
+		return nil, err
+	}
+	return &pii, nil
+}
+
+//putUserPII writes the personal data to the collection and sets the pseudonym and the hash of the public user
+//a user who already has a pseudonym keeps it - it is his public id, see updateUser
+func putUserPII(stub shim.ChaincodeStubInterface, user *User, pii UserPII) error {
+
+	if len(pii.Salt) < minSaltLength {
+		return errors.New("the salt has to be at least " + strconv.Itoa(minSaltLength) + " characters long")
+	}
+
+	pii.Id = user.Id
+	if user.Pseudonym == "" {
+		user.Pseudonym = pseudonymOf(pii.Salt, user.Id)
+	}
+	user.NameHash = saltedHash(pii.Salt, pii.Name)
+
+	piiAsBytes, _ := json.Marshal(pii)
+	return stub.PutPrivateData(collectionUserPII, "user"+strconv.Itoa(user.Id), piiAsBytes)
+}
+
+//hasNameField is true if a public user JSON still has a name - names have to go through the transient map
+func hasNameField(userJSON []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(userJSON, &fields); err != nil {
+		return false
+	}
+	_, found := fields["name"]
+	return found
+}
+
+//=====================================GET USER PII===========================================
+func (cc *CRUD) getUserPII(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "userId"
+	//only a peer of an org of the collection can answer this one - and only to an admin or the user himself
+	userId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven userId cant be converted to an int")
+	}
+	if !isAdmin(stub) {
+		if callerId, err := callerUserId(stub); err != nil || callerId != userId {
+			return Error(http.StatusForbidden, codeAdminRequired, "only an admin or the user himself can read his personal data")
+		}
+	}
+
+	pii, err := getUserPIIOfUser(stub, userId)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if pii == nil {
+		return Error(http.StatusNotFound, codePIINotFound, "Personal Data Not Found")
+	}
+
+	//the salt never leaves the collection, with it the pseudonym could be linked to the name again
+	piiAsBytes, _ := json.Marshal(CheckUserPIIParameter{Name: pii.Name})
+	return Success(http.StatusOK, "OK", piiAsBytes)
+}
+
+//=====================================ERASE USER=============================================
+func (cc *CRUD) eraseUser(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "userId"
+	//right to erasure (GDPR art. 17) - the personal data is deleted and the user becomes a tombstone
+	//the tombstone keeps the key "user1", so the id is never given to somebody else and the travelLogs
+	//and statistics of the user still point to a user - they just cant be linked to a person anymore
+	//the travelLogs themselves are not changed, they are hash chained and the logbook has to stay complete
+
+	ledgerUser, err := stub.GetState("user" + args[0])
+	if err != nil || ledgerUser == nil {
+		return Error(http.StatusNotFound, codeUserNotFound, "User Not Found")
+	}
+	var user User
+	json.Unmarshal(ledgerUser, &user)
+
+	if user.Erased {
+		return Error(http.StatusGone, codeUserErased, "the user is already erased")
+	}
+	if user.BorrowId != 0 {
+		return Error(http.StatusConflict, codeUserAlreadyBorrowing, "the user has to return his car before he can be erased")
+	}
+
+	key := "user" + strconv.Itoa(user.Id)
+	if err := stub.DelPrivateData(collectionUserPII, key); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	//this is the erasure of the personal data - the collections have blockToLive 0, nothing expires by itself
+	//the old versions stay in the private data store of the member peers until the channel is migrated
+
+	//a user without a pseudonym (never had personal data) gets one from the txId, the salt is gone anyway
+	pseudonym := user.Pseudonym
+	if pseudonym == "" {
+		pseudonym = pseudonymOf(stub.GetTxID(), user.Id)
+	}
+	tombstone := User{
+		Id:        user.Id,
+		Pseudonym: pseudonym,
+		Erased:    true,
+		ErasedAt:  ledgerNow(stub).Format(timeFormat),
+	}
+
+	//the history of the key still has the old versions - since user-033 these only have the hash of the name
+	//a user created before still has his plain name in the history (and in the blocks of createUser and updateUser)
+	//eraseUser cant remove it, only a fresh channel filled with exportLedger/importLedger has no history
+	tombstoneAsBytes, _ := json.Marshal(tombstone)
+	if err := stub.PutState(key, tombstoneAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, "Update user failed")
+	}
+
+	stub.SetEvent("User erased", []byte("user: "+args[0]))
+	return Success(http.StatusOK, "OK", tombstoneAsBytes)
+}
+
+//=====================================EXPORT USER PII========================================
+func (cc *CRUD) exportUserPII(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//exportLedger has no personal data - this one is the rest of the export, with the salts
+	//only evaluate it on a peer of an org of the collection and never submit it, the answer would end up in a block
+
+	resultsIterator, err := stub.GetPrivateDataByRange(collectionUserPII, "user", "usf")
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	exported := []CheckBulkUserPIIParameter{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		var pii UserPII
+		if err := json.Unmarshal(queryResponse.Value, &pii); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, "Unmarshalling "+queryResponse.Key+" failed")
+		}
+		exported = append(exported, CheckBulkUserPIIParameter{Id: pii.Id, Name: pii.Name, Salt: pii.Salt})
+	}
+
+	exportedAsBytes, _ := json.Marshal(exported)
+	return Success(http.StatusOK, "OK", exportedAsBytes)
+}
+
+//=====================================IMPORT USER PII========================================
+func (cc *CRUD) importUserPII(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(transient) -> "users": the answer of exportUserPII, [{"id":4,"name":"Alice","salt":"8c1f0e4b2a7d93e6"}]
+	//after the last page of importLedger - the public users have to be there, only the collection is written
+
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	var overgivenPII []CheckBulkUserPIIParameter
+	if err := json.Unmarshal(transient[transientUsersPII], &overgivenPII); err != nil {
+		return Error(http.StatusBadRequest, codeInvalidPersonalData, "the transient map needs the key users with the answer of exportUserPII")
+	}
+	if len(overgivenPII) == 0 {
+		return Error(http.StatusBadRequest, codeInvalidPersonalData, "there is no personal data to import")
+	}
+
+	//a name is only imported if it is the one the public user was made with - else the hash and the pseudonym would not fit
+	rowErrors := []BulkRowError{}
+	seen := map[int]int{}
+	for i, pii := range overgivenPII {
+		row := i + 1
+		if firstRow, found := seen[pii.Id]; found {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: pii.Id, Error: "the id is already in row " + strconv.Itoa(firstRow)})
+			continue
+		}
+		seen[pii.Id] = row
+
+		if pii.Name == "" || len(pii.Salt) < minSaltLength {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: pii.Id, Error: "the name cant be empty and the salt has to be at least " + strconv.Itoa(minSaltLength) + " characters long"})
+			continue
+		}
+		ledgerUser, err := stub.GetState("user" + strconv.Itoa(pii.Id))
+		if err != nil || ledgerUser == nil {
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: pii.Id, Error: "the user does not exist - import the ledger first"})
+			continue
+		}
+		var user User
+		json.Unmarshal(ledgerUser, &user)
+		switch {
+		case user.Erased:
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: pii.Id, Error: "the user was erased"})
+		case user.NameHash != saltedHash(pii.Salt, pii.Name) || user.Pseudonym != pseudonymOf(pii.Salt, pii.Id):
+			rowErrors = append(rowErrors, BulkRowError{Row: row, Id: pii.Id, Error: "the name or the salt does not fit the hash of the user"})
+		}
+	}
+	if len(rowErrors) != 0 {
+		return bulkResponse(0, rowErrors)
+	}
+
+	for _, pii := range overgivenPII {
+		piiAsBytes, _ := json.Marshal(UserPII{Id: pii.Id, Name: pii.Name, Salt: pii.Salt})
+		if err := stub.PutPrivateData(collectionUserPII, "user"+strconv.Itoa(pii.Id), piiAsBytes); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+	}
+
+	stub.SetEvent("Personal data imported", []byte(strconv.Itoa(len(overgivenPII))+" users"))
+	return bulkResponse(len(overgivenPII), rowErrors)
+}
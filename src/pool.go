@@ -0,0 +1,171 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//=========================================================================================== POOLS
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//a group of cars of a branch or a department - ledger key "pool1"
+//a car is in one pool (or in none, then everybody can borrow it), a user can be entitled to many pools
+type Pool struct {
+	Id            int    `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//isEntitled is true if the user is allowed to borrow the car
+func isEntitled(user User, car Car) bool {
+	if car.PoolId == 0 {
+		return true
+	}
+	for _, poolId := range user.Pools {
+		if poolId == car.PoolId {
+			return true
+		}
+	}
+	return false
+}
+
+func poolExists(stub shim.ChaincodeStubInterface, poolId int) bool {
+	ledgerPool, err := stub.GetState("pool" + strconv.Itoa(poolId))
+	return err == nil && ledgerPool != nil
+}
+
+//=====================================CREATE POOL============================================
+func (cc *CRUD) createPool(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "id"
+	//(body) -> args[1]: {"id":1,"name":"Walldorf","description":"all cars of the Walldorf branch"}
+
+	if obj, err := stub.GetState("pool" + args[0]); err != nil || obj != nil {
+		return Error(http.StatusConflict, codePoolAlreadyExists, "a pool with this id already exists")
+	}
+
+	var pool Pool
+	if response, ok := decodeBody("pool", args[1], documentFields(&pool)); !ok {
+		return response
+	}
+	details := []FieldError{}
+	if pool.Id <= 0 {
+		details = append(details, fieldError("id", "has to be greater than 0"))
+	}
+	if pool.Name == "" {
+		details = append(details, fieldError("name", "cant be empty"))
+	}
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
+	}
+	if strconv.Itoa(pool.Id) != args[0] {
+		return Error(http.StatusBadRequest, codeIdMismatch, "id of path and id of pool are different!")
+	}
+
+	poolAsBytes, _ := json.Marshal(pool)
+	if err := stub.PutState("pool"+args[0], poolAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Pool created", poolAsBytes)
+	return Success(http.StatusCreated, "Created", nil)
+}
+
+//=====================================GET ALL POOLS==========================================
+func (cc *CRUD) getAllPools(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+
+	resultsIterator, err := stub.GetStateByRange("pool", "poom")
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	pools := []Pool{}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+
+		var pool Pool
+		json.Unmarshal(it.Value, &pool)
+		pools = append(pools, pool)
+	}
+
+	poolsAsBytes, _ := json.Marshal(pools)
+	return Success(http.StatusOK, "OK", poolsAsBytes)
+}
+
+//=====================================ASSIGN CAR TO POOL=====================================
+func (cc *CRUD) assignCarToPool(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId"
+	//(body) -> args[1]: "poolId" - 0 takes the car out of its pool
+
+	poolId, err := strconv.Atoi(args[1])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven poolId cant be converted to an int")
+	}
+	if poolId != 0 && !poolExists(stub, poolId) {
+		return Error(http.StatusNotFound, codePoolNotFound, "Pool Not Found")
+	}
+
+	ledgerCar, err := stub.GetState("car" + args[0])
+	if err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found")
+	}
+	var car Car
+	json.Unmarshal(ledgerCar, &car)
+
+	car.PoolId = poolId
+	carAsBytes, _ := json.Marshal(car)
+	if err := stub.PutState("car"+strconv.Itoa(car.Id), carAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, "Update car failed")
+	}
+
+	stub.SetEvent("Car assigned to pool", []byte("car: "+args[0]+" pool: "+args[1]))
+	return Success(http.StatusOK, "OK", []byte("Car assigned to pool"))
+}
+
+//=====================================SET USER POOLS=========================================
+func (cc *CRUD) setUserPools(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "userId"
+	//(body) -> args[1]: [1,2]
+
+	var pools []int
+	if response, ok := decodeBody("pools", args[1], &pools); !ok {
+		return response
+	}
+	for _, poolId := range pools {
+		if !poolExists(stub, poolId) {
+			return Error(http.StatusNotFound, codePoolNotFound, "Pool Not Found - "+strconv.Itoa(poolId))
+		}
+	}
+
+	ledgerUser, err := stub.GetState("user" + args[0])
+	if err != nil || ledgerUser == nil {
+		return Error(http.StatusNotFound, codeUserNotFound, "User Not Found")
+	}
+	var user User
+	json.Unmarshal(ledgerUser, &user)
+	if user.Erased {
+		return Error(http.StatusGone, codeUserErased, "the user was erased")
+	}
+
+	user.Pools = pools
+	userAsBytes, _ := json.Marshal(user)
+	if err := stub.PutState("user"+strconv.Itoa(user.Id), userAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, "Update user failed")
+	}
+
+	stub.SetEvent("User pools changed", []byte("user: "+args[0]+" pools: "+args[1]))
+	return Success(http.StatusOK, "OK", []byte("User pools changed"))
+}
@@ -0,0 +1,198 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//============================================================================================== QR
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//a car without an NFC reader shows a QR code on its display (or the fleet admin prints one)
+//the secret in it proves the driver stands at the car - who borrows or returns is the caller, like in userBorrowACar
+const qrTokenMaxAge = 5 * time.Minute
+
+//the display makes the secret itself and overgives it in the transient map, so it is in no block and no state
+//the driver overgives the scanned secret the same way to qrBorrow and qrReturn
+const (
+	transientQrSecret = "qrSecret"
+	minQrSecretLength = 32
+)
+
+//a QR token for a car - ledger key "qrToken" + TokenHash, the hash is hex(sha256(secret))
+//a used token is deleted, the borrow or the travelLog it was used for stays
+type QrToken struct {
+	TokenHash     string `json:"tokenHash"`
+	CarId         int    `json:"carId"`
+	Issued        string `json:"issued"`
+	Expires       string `json:"expires"`
+	IssuedBy      string `json:"issuedBy"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//this one is just for internal Operations in func qrBorrow - the body can be left out if the checklist has no mandatory item
+type CheckQrBorrowParameter struct {
+	Checklist []ChecklistAnswer `json:"checklist"`
+}
+
+//canIssueQrToken is true for an admin and for a registered box (the display) of the car
+func canIssueQrToken(stub shim.ChaincodeStubInterface, carId int) bool {
+	if isAdmin(stub) {
+		return true
+	}
+	deviceId, ok := callerDeviceId(stub)
+	if !ok {
+		return false
+	}
+	ledgerDevice, err := stub.GetState("dev" + strconv.Itoa(deviceId))
+	if err != nil || ledgerDevice == nil {
+		return false
+	}
+	var device TelematicsDevice
+	json.Unmarshal(ledgerDevice, &device)
+	return device.CarId == carId
+}
+
+//qrTokenHash is the part of the key of a token - the secret itself is never written
+func qrTokenHash(secret string) string {
+	digest := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(digest[:])
+}
+
+//readTransientQrSecret is the secret of the transient map
+func readTransientQrSecret(stub shim.ChaincodeStubInterface) (string, peer.Response, bool) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return "", Error(http.StatusInternalServerError, codeInternal, err.Error()), false
+	}
+	secret := string(transient[transientQrSecret])
+	if len(secret) < minQrSecretLength {
+		return "", Error(http.StatusBadRequest, codeQrRejected, "the transient map needs the key "+transientQrSecret+" with at least "+strconv.Itoa(minQrSecretLength)+" characters", fieldError(transientQrSecret, "is missing or too short")), false
+	}
+	return secret, peer.Response{}, true
+}
+
+//useQrToken checks the secret of the transient map and deletes its token
+//a rejected borrow or return is not written at all, so the token is only used up by one that works
+func useQrToken(stub shim.ChaincodeStubInterface) (QrToken, peer.Response, bool) {
+
+	secret, response, ok := readTransientQrSecret(stub)
+	if !ok {
+		return QrToken{}, response, false
+	}
+	key := "qrToken" + qrTokenHash(secret)
+	ledgerToken, err := stub.GetState(key)
+	if err != nil || ledgerToken == nil {
+		return QrToken{}, Error(http.StatusForbidden, codeQrRejected, "the token was never issued or was already used", fieldError(transientQrSecret, "is unknown")), false
+	}
+	var qrToken QrToken
+	json.Unmarshal(ledgerToken, &qrToken)
+
+	if ledgerNow(stub).Format(timeFormat) > qrToken.Expires {
+		return QrToken{}, Error(http.StatusForbidden, codeQrRejected, "the token expired", fieldError(transientQrSecret, "expired at "+qrToken.Expires)), false
+	}
+	if err := stub.DelState(key); err != nil {
+		return QrToken{}, Error(http.StatusInternalServerError, codeInternal, err.Error()), false
+	}
+	return qrToken, peer.Response{}, true
+}
+
+//=====================================ISSUE QR TOKEN=========================================
+func (cc *CRUD) issueQrToken(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId"
+	//(transient) -> "qrSecret": the random secret the display shows in the QR code
+	//an admin or the display of the car - the display is a registered box with the attribute deviceId
+
+	carId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "Cant Atoi args[0] ")
+	}
+	if ledgerCar, err := stub.GetState("car" + args[0]); err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found")
+	}
+	if !canIssueQrToken(stub, carId) {
+		return Error(http.StatusForbidden, codeAdminRequired, "only an admin or the display of the car can issue a token")
+	}
+
+	secret, response, ok := readTransientQrSecret(stub)
+	if !ok {
+		return response
+	}
+	tokenHash := qrTokenHash(secret)
+	if obj, err := stub.GetState("qrToken" + tokenHash); err != nil || obj != nil {
+		return Error(http.StatusConflict, codeQrRejected, "this secret was already issued - the display needs a new one")
+	}
+
+	now := ledgerNow(stub)
+	qrToken := QrToken{
+		TokenHash: tokenHash,
+		CarId:     carId,
+		Issued:    now.Format(timeFormat),
+		Expires:   now.Add(qrTokenMaxAge).Format(timeFormat),
+		IssuedBy:  callerId(stub),
+	}
+	tokenAsBytes, _ := json.Marshal(qrToken)
+	if err := stub.PutState("qrToken"+tokenHash, tokenAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	return Success(http.StatusCreated, "Created", tokenAsBytes)
+}
+
+//=====================================QR BORROW==============================================
+func (cc *CRUD) qrBorrow(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(body) -> args[0]: {"checklist":[{"item":"fuelLevel","value":80}]} or ""
+	//(transient) -> "qrSecret": the scanned secret - the caller borrows the car of the token, the userId is in his certificate
+
+	var overgivenParam CheckQrBorrowParameter
+	if args[0] != "" {
+		if response, ok := decodeBody("borrow", args[0], &overgivenParam); !ok {
+			return response
+		}
+	}
+
+	userId, err := callerUserId(stub)
+	if err != nil {
+		return Error(http.StatusForbidden, codeCallerUnknown, err.Error())
+	}
+	qrToken, response, ok := useQrToken(stub)
+	if !ok {
+		return response
+	}
+
+	//the car is picked up where it is
+	return borrowCar(stub, userId, CheckBorrowCarParameter{CarId: qrToken.CarId, Checklist: overgivenParam.Checklist}, " by qr")
+}
+
+//=====================================QR RETURN==============================================
+func (cc *CRUD) qrReturn(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(body) -> args[0]: like userReturnACar
+	//(transient) -> "qrSecret": the scanned secret - the caller returns the car of the token, the userId is in his certificate
+
+	userId, err := callerUserId(stub)
+	if err != nil {
+		return Error(http.StatusForbidden, codeCallerUnknown, err.Error())
+	}
+	var overgivenParam CheckReturnCarParameter
+	if response, ok := decodeBody("return", args[0], &overgivenParam); !ok {
+		return response
+	}
+	qrToken, response, ok := useQrToken(stub)
+	if !ok {
+		return response
+	}
+
+	return returnCar(stub, strconv.Itoa(userId), overgivenParam, qrToken.CarId, " by qr")
+}
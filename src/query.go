@@ -0,0 +1,228 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//=========================================================================================== QUERY
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//ListOptions is how a list is sorted and which fields of the records are in it
+//the fields are the json names, a field of a nested object is "location.siteId"
+//sort "-km,id" is the most km first and the same km by id - without sort the list is in key order
+type ListOptions struct {
+	Sort   []SortField
+	Fields []string
+}
+
+type SortField struct {
+	Path       string
+	Descending bool
+}
+
+//fieldPaths are all paths of the JSON of a record - the arrays are not looked into
+func fieldPaths(record interface{}) map[string]bool {
+	paths := map[string]bool{}
+	var walk func(prefix string, document map[string]interface{})
+	walk = func(prefix string, document map[string]interface{}) {
+		for name, value := range document {
+			paths[prefix+name] = true
+			if nested, ok := value.(map[string]interface{}); ok {
+				walk(prefix+name+".", nested)
+			}
+		}
+	}
+	recordAsBytes, _ := json.Marshal(record)
+	var document map[string]interface{}
+	json.Unmarshal(recordAsBytes, &document)
+	walk("", document)
+	return paths
+}
+
+//parseListOptions reads the sort and fields parameters of a list for records like record
+func parseListOptions(record interface{}, sortParam string, fieldsParam string) (ListOptions, []FieldError) {
+	paths := fieldPaths(record)
+	options := ListOptions{}
+	details := []FieldError{}
+
+	for _, name := range splitList(sortParam) {
+		field := SortField{Path: strings.TrimPrefix(name, "-"), Descending: strings.HasPrefix(name, "-")}
+		if !paths[field.Path] {
+			details = append(details, fieldError("sort", field.Path+" is no field"))
+			continue
+		}
+		options.Sort = append(options.Sort, field)
+	}
+	for _, name := range splitList(fieldsParam) {
+		if !paths[name] {
+			details = append(details, fieldError("fields", name+" is no field"))
+			continue
+		}
+		options.Fields = append(options.Fields, name)
+	}
+	return options, details
+}
+
+//splitList splits "a, b,c" into its names
+func splitList(param string) []string {
+	names := []string{}
+	for _, name := range strings.Split(param, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+//valueAt is the value of a path in a document, nil if it is not there
+func valueAt(document map[string]interface{}, path string) interface{} {
+	var value interface{} = document
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+//compareValues orders nil before false before true before numbers before strings - arrays and objects are equal
+func compareValues(a interface{}, b interface{}) int {
+	rank := func(value interface{}) int {
+		switch value.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case json.Number:
+			return 2
+		case string:
+			return 3
+		}
+		return 4
+	}
+	if rank(a) != rank(b) {
+		return rank(a) - rank(b)
+	}
+
+	switch a := a.(type) {
+	case bool:
+		if a == b.(bool) {
+			return 0
+		}
+		if !a {
+			return -1
+		}
+		return 1
+	case json.Number:
+		x, _ := a.Float64()
+		y, _ := b.(json.Number).Float64()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+//projectDocument is a document with just the fields - a nested field stays in its object
+func projectDocument(document map[string]interface{}, fields []string) map[string]interface{} {
+	projected := map[string]interface{}{}
+	for _, path := range fields {
+		names := strings.Split(path, ".")
+		target := projected
+		for _, name := range names[:len(names)-1] {
+			nested, ok := target[name].(map[string]interface{})
+			if !ok {
+				nested = map[string]interface{}{}
+				target[name] = nested
+			}
+			target = nested
+		}
+		target[names[len(names)-1]] = valueAt(document, path)
+	}
+	return projected
+}
+
+//listResponse is the answer of a list with the options applied - records is a slice of records
+//the records are sorted stable, so records with the same values stay in key order
+func listResponse(records interface{}, options ListOptions) peer.Response {
+
+	recordsAsBytes, _ := json.Marshal(records)
+	if len(options.Sort) == 0 && len(options.Fields) == 0 {
+		return Success(http.StatusOK, "OK", recordsAsBytes)
+	}
+
+	//json.Number keeps the numbers as they are, a float64 could change a big one
+	var documents []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(recordsAsBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&documents); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	sort.SliceStable(documents, func(i, j int) bool {
+		for _, field := range options.Sort {
+			compared := compareValues(valueAt(documents[i], field.Path), valueAt(documents[j], field.Path))
+			if compared == 0 {
+				continue
+			}
+			if field.Descending {
+				return compared > 0
+			}
+			return compared < 0
+		}
+		return false
+	})
+
+	if len(options.Fields) != 0 {
+		for i := range documents {
+			documents[i] = projectDocument(documents[i], options.Fields)
+		}
+	}
+
+	documentsAsBytes, _ := json.Marshal(documents)
+	return Success(http.StatusOK, "OK", documentsAsBytes)
+}
+
+//parseOptionalBool is "" for no filter, else true or false
+func parseOptionalBool(name string, param string) (*bool, []FieldError) {
+	if param == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(param)
+	if err != nil {
+		return nil, []FieldError{fieldError(name, "has to be true or false")}
+	}
+	return &value, nil
+}
+
+//parseOptionalInt is "" for no filter, else the int
+func parseOptionalInt(name string, param string) (*int, []FieldError) {
+	if param == "" {
+		return nil, nil
+	}
+	value, err := strconv.Atoi(param)
+	if err != nil {
+		return nil, []FieldError{fieldError(name, "has to be an integer")}
+	}
+	return &value, nil
+}
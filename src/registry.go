@@ -0,0 +1,452 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//======================================================================================== REGISTRY
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//where an argument comes from in the REST definition
+const (
+	inPath  = "path"
+	inQuery = "query"
+	inBody  = "body"
+)
+
+//the types of an argument - "json" is a body that has to be a JSON document with the schema of the argument
+const (
+	argInteger = "integer"
+	argNumber  = "number"
+	argBoolean = "boolean"
+	argString  = "string"
+	argJSON    = "json"
+)
+
+//everybody with a certificate of the channel can call a function of roleAnyone
+const roleAnyone = "anyone"
+
+//FunctionSpec is everything the chaincode knows about a function before it is called
+//an optional argument can be empty or left out - left out ones are overgiven as "" to the handler
+//Method and Path are the REST call of the function, the path arguments are in the path as {name}
+//result is a value of the go type of the data of a successful answer, e.g. Car{} or []Car{} - nil is just a message
+//Returns is the name of it ("Car", "[]Car", "object" or "array"), it is set in init
+type FunctionSpec struct {
+	Name        string    `json:"name"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Description string    `json:"description"`
+	Role        string    `json:"role"`
+	Query       bool      `json:"query"`
+	Args        []ArgSpec `json:"args"`
+	Returns     string    `json:"returns,omitempty"`
+	result      interface{}
+	handler     func(cc *CRUD, stub shim.ChaincodeStubInterface, args []string) peer.Response
+}
+
+type ArgSpec struct {
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Type     string      `json:"type"`
+	Optional bool        `json:"optional"`
+	Schema   *BodySchema `json:"schema,omitempty"`
+	MaxSize  int         `json:"maxSize,omitempty"`
+}
+
+//BodySchema is the look of a JSON argument - Model is the name of the go type it is decoded to
+//Items is the type of the entries of an array, Required are the fields an object cant be without
+type BodySchema struct {
+	Type      string   `json:"type"`
+	Model     string   `json:"model,omitempty"`
+	Items     string   `json:"items,omitempty"`
+	Required  []string `json:"required,omitempty"`
+	modelType reflect.Type
+}
+
+//the registry is filled in init, a function that is not in it cant be called
+var functionRegistry []FunctionSpec
+var functionsByName map[string]*FunctionSpec
+
+//shortcuts for the arguments of the registry
+func pathArg(name string) ArgSpec {
+	return ArgSpec{Name: name, In: inPath, Type: argInteger}
+}
+
+func queryArg(name string, argType string) ArgSpec {
+	return ArgSpec{Name: name, In: inQuery, Type: argType, Optional: true}
+}
+
+func bodyArg(name string, argType string, schema *BodySchema) ArgSpec {
+	return ArgSpec{Name: name, In: inBody, Type: argType, Schema: schema, MaxSize: maxBodySize}
+}
+
+func bulkBodyArg(name string, argType string, schema *BodySchema) ArgSpec {
+	return ArgSpec{Name: name, In: inBody, Type: argType, Schema: schema, MaxSize: maxBulkBodySize}
+}
+
+//objectBody takes a value of the go type the body is decoded to, e.g. objectBody(Car{}, "id")
+func objectBody(model interface{}, required ...string) *BodySchema {
+	modelType := reflect.TypeOf(model)
+	return &BodySchema{Type: "object", Model: modelType.Name(), Required: required, modelType: modelType}
+}
+
+//modelName is the name of a go type in Returns
+func modelName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Map:
+		return "object"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Interface {
+			return "array"
+		}
+		return "[]" + modelName(t.Elem())
+	}
+	return t.Name()
+}
+
+func init() {
+	functionRegistry = []FunctionSpec{
+		//CAR OPERATIONS
+		{Name: "createCar", Method: "post", Path: "/cars/{id}", Description: "create a car", Role: roleAdmin, handler: (*CRUD).createCar,
+			Args: []ArgSpec{pathArg("id"), bodyArg("car", argJSON, objectBody(Car{}, "id", "km"))}},
+		{Name: "getCarById", Method: "get", Path: "/cars/{id}", result: Car{}, Description: "get a car", Role: roleAnyone, Query: true, handler: (*CRUD).getCar,
+			Args: []ArgSpec{pathArg("id")}},
+		{Name: "updateCar", Method: "put", Path: "/cars/{id}", Description: "update a car - a km correction needs an admin", Role: roleAnyone, handler: (*CRUD).updateCar,
+			Args: []ArgSpec{pathArg("id"), bodyArg("car", argJSON, objectBody(Car{}, "id", "km")), queryArg("reason", argString)}},
+		{Name: "deleteCar", Method: "delete", Path: "/cars/{id}", Description: "delete a car that never drove with its reservations, keys and boxes - a car with trips is set inactive instead", Role: roleAdmin, handler: (*CRUD).deleteCar,
+			Args: []ArgSpec{pathArg("id")}},
+		{Name: "getAllCars", Method: "get", Path: "/cars", result: []Car{}, Description: "get all cars, filtered, sorted and with just some fields - \"mine\" are the ones the caller is allowed to borrow", Role: roleAnyone, Query: true, handler: (*CRUD).getAllCars,
+			Args: []ArgSpec{queryArg("pools", argString), queryArg("available", argBoolean), queryArg("minKm", argInteger), queryArg("maxKm", argInteger),
+				queryArg("category", argString), queryArg("sort", argString), queryArg("fields", argString)}},
+		{Name: "getCarsAtLocation", Method: "get", Path: "/carsAtLocation", result: []Car{}, Description: "get the cars at a site or in a radius around a position", Role: roleAnyone, Query: true, handler: (*CRUD).getCarsAtLocation,
+			Args: []ArgSpec{queryArg("siteId", argInteger), queryArg("lat", argNumber), queryArg("long", argNumber), queryArg("radius", argNumber)}},
+		{Name: "bulkCreateCars", Method: "post", Path: "/cars/bulk", result: BulkResult{}, Description: "create many cars from a JSON array or CSV", Role: roleAdmin, handler: (*CRUD).bulkCreateCars,
+			Args: []ArgSpec{bulkBodyArg("cars", argString, nil)}},
+
+		//SITE OPERATIONS
+		{Name: "createSite", Method: "post", Path: "/sites/{id}", Description: "create a site", Role: roleAdmin, handler: (*CRUD).createSite,
+			Args: []ArgSpec{pathArg("id"), bodyArg("site", argJSON, objectBody(Site{}, "id", "name"))}},
+		{Name: "getAllSites", Method: "get", Path: "/sites", result: []Site{}, Description: "get all sites", Role: roleAnyone, Query: true, handler: (*CRUD).getAllSites},
+
+		//USER OPERATIONS
+		{Name: "createUser", Method: "post", Path: "/users/{id}", Description: "create a user - the name comes in the transient map", Role: roleAdmin, handler: (*CRUD).createUser,
+			Args: []ArgSpec{pathArg("id"), bodyArg("user", argJSON, objectBody(User{}, "id"))}},
+		{Name: "getUserById", Method: "get", Path: "/users/{id}", result: User{}, Description: "get a user", Role: roleAnyone, Query: true, handler: (*CRUD).getUser,
+			Args: []ArgSpec{pathArg("id")}},
+		{Name: "updateUser", Method: "put", Path: "/users/{id}", Description: "update a user - a new name comes in the transient map", Role: roleAnyone, handler: (*CRUD).updateUser,
+			Args: []ArgSpec{pathArg("id"), bodyArg("user", argJSON, objectBody(User{}, "id"))}},
+		{Name: "deleteUser", Method: "delete", Path: "/users/{id}", Description: "delete a user and his personal data", Role: roleAdmin, handler: (*CRUD).deleteUser,
+			Args: []ArgSpec{pathArg("id")}},
+		{Name: "getAllUser", Method: "get", Path: "/users", result: []User{}, Description: "get all users, filtered, sorted and with just some fields", Role: roleAnyone, Query: true, handler: (*CRUD).getAllUser,
+			Args: []ArgSpec{queryArg("borrowing", argBoolean), queryArg("pseudonymPrefix", argString), queryArg("sort", argString), queryArg("fields", argString)}},
+		{Name: "bulkCreateUsers", Method: "post", Path: "/users/bulk", result: BulkResult{}, Description: "create many users from a JSON array or CSV", Role: roleAdmin, handler: (*CRUD).bulkCreateUsers,
+			Args: []ArgSpec{bulkBodyArg("users", argString, nil)}},
+		{Name: "getUserPII", Method: "get", Path: "/users/pii/{userId}", result: CheckUserPIIParameter{}, Description: "get the personal data of a user - an admin or the user himself", Role: roleAnyone, Query: true, handler: (*CRUD).getUserPII,
+			Args: []ArgSpec{pathArg("userId")}},
+		{Name: "eraseUser", Method: "post", Path: "/users/erase/{userId}", result: User{}, Description: "erase the personal data of a user and leave a tombstone", Role: roleAdmin, handler: (*CRUD).eraseUser,
+			Args: []ArgSpec{pathArg("userId")}},
+		{Name: "verifyLicence", Method: "put", Path: "/users/licence/{userId}", Description: "record the verified driving licence of a user", Role: roleAdmin, handler: (*CRUD).verifyLicence,
+			Args: []ArgSpec{pathArg("userId"), bodyArg("licence", argJSON, objectBody(CheckVerifyLicenceParameter{}, "classes", "expiry"))}},
+		{Name: "setUserPools", Method: "put", Path: "/users/pools/{userId}", Description: "set the pools a user is entitled to", Role: roleAdmin, handler: (*CRUD).setUserPools,
+			Args: []ArgSpec{pathArg("userId"), bodyArg("pools", argJSON, &BodySchema{Type: "array", Items: argInteger})}},
+
+		//POOL OPERATIONS
+		{Name: "createPool", Method: "post", Path: "/pools/{id}", Description: "create a pool", Role: roleAdmin, handler: (*CRUD).createPool,
+			Args: []ArgSpec{pathArg("id"), bodyArg("pool", argJSON, objectBody(Pool{}, "id", "name"))}},
+		{Name: "getAllPools", Method: "get", Path: "/pools", result: []Pool{}, Description: "get all pools", Role: roleAnyone, Query: true, handler: (*CRUD).getAllPools},
+		{Name: "transferCar", Method: "put", Path: "/cars/owner/{carId}", result: Car{}, Description: "transfer a car to another owning org - its peers endorse the car from then on", Role: roleAdmin, handler: (*CRUD).transferCar,
+			Args: []ArgSpec{pathArg("carId"), bodyArg("ownerOrg", argString, nil)}},
+		{Name: "assignCarToPool", Method: "put", Path: "/cars/pool/{carId}", Description: "put a car in a pool - 0 takes it out", Role: roleAdmin, handler: (*CRUD).assignCarToPool,
+			Args: []ArgSpec{pathArg("carId"), bodyArg("poolId", argInteger, nil)}},
+
+		//AVAILABILITY
+		{Name: "findAvailableCars", Method: "get", Path: "/cars/available", result: []AvailableCar{}, Description: "get the cars that are free from start to end, the best fit first", Role: roleAnyone, Query: true, handler: (*CRUD).findAvailableCars,
+			Args: []ArgSpec{{Name: "start", In: inQuery, Type: argString}, {Name: "end", In: inQuery, Type: argString},
+				queryArg("seats", argInteger), queryArg("fuelType", argString), queryArg("rangeKm", argInteger)}},
+		{Name: "createReservation", Method: "post", Path: "/reservations/{userId}", result: Reservation{}, Description: "reserve a car for a user from start to end", Role: roleAnyone, handler: (*CRUD).createReservation,
+			Args: []ArgSpec{pathArg("userId"), bodyArg("reservation", argJSON, objectBody(CheckReservationParameter{}, "carId", "start", "end"))}},
+		{Name: "cancelReservation", Method: "delete", Path: "/reservations/{carId}/{reservationId}", result: Reservation{}, Description: "cancel a reservation - an admin or the user of the reservation", Role: roleAnyone, handler: (*CRUD).cancelReservation,
+			Args: []ArgSpec{pathArg("carId"), pathArg("reservationId")}},
+		{Name: "createMaintenanceBlock", Method: "post", Path: "/maintenance", result: MaintenanceBlock{}, Description: "block a car for the workshop from start to end", Role: roleAdmin, handler: (*CRUD).createMaintenanceBlock,
+			Args: []ArgSpec{bodyArg("maintenance", argJSON, objectBody(CheckMaintenanceParameter{}, "carId", "start", "end", "reason"))}},
+		{Name: "deleteMaintenanceBlock", Method: "delete", Path: "/maintenance/{carId}/{maintenanceId}", Description: "delete a maintenance block", Role: roleAdmin, handler: (*CRUD).deleteMaintenanceBlock,
+			Args: []ArgSpec{pathArg("carId"), pathArg("maintenanceId")}},
+
+		//USER OPERATION
+		{Name: "userBorrowACar", Method: "put", Path: "/users/borrowCar/{userId}", Description: "a user borrows a car", Role: roleAnyone, handler: (*CRUD).userBorrowACar,
+			Args: []ArgSpec{pathArg("userId"), bodyArg("borrow", argJSON, objectBody(CheckBorrowCarParameter{}, "carId"))}},
+		{Name: "userReturnACar", Method: "put", Path: "/users/returnCar/{userId}", Description: "a user returns his car and a travelLog is written", Role: roleAnyone, handler: (*CRUD).userReturnACar,
+			Args: []ArgSpec{pathArg("userId"), bodyArg("return", argJSON, objectBody(CheckReturnCarParameter{}, "newKm", "usage"))}},
+		{Name: "getAllTravelLogsForUser", Method: "get", Path: "/users/ownTravelLogs/{userId}", result: []TravelLog{}, Description: "get all travelLogs of a user", Role: roleAnyone, Query: true, handler: (*CRUD).getAllTravelLogsForUser,
+			Args: []ArgSpec{pathArg("userId")}},
+
+		//STATISTICS
+		{Name: "getCarStats", Method: "get", Path: "/stats/cars/{carId}", result: UsageStatsReport{}, Description: "get the monthly usage statistics of a car", Role: roleAnyone, Query: true, handler: (*CRUD).getCarStats,
+			Args: []ArgSpec{pathArg("carId")}},
+		{Name: "getUserStats", Method: "get", Path: "/stats/users/{userId}", result: UsageStatsReport{}, Description: "get the monthly usage statistics of a user", Role: roleAnyone, Query: true, handler: (*CRUD).getUserStats,
+			Args: []ArgSpec{pathArg("userId")}},
+		{Name: "getFleetStats", Method: "get", Path: "/stats/fleet", result: UsageStatsReport{}, Description: "get the monthly usage statistics of the fleet", Role: roleAnyone, Query: true, handler: (*CRUD).getFleetStats},
+
+		//LOGBOOK
+		{Name: "setLogbookMode", Method: "put", Path: "/logbook/{carId}", Description: "switch the logbook mode of a car", Role: roleAdmin, handler: (*CRUD).setLogbookMode,
+			Args: []ArgSpec{pathArg("carId"), bodyArg("enabled", argBoolean, nil)}},
+		{Name: "getLogbook", Method: "get", Path: "/logbook/{carId}", result: LogbookReport{}, Description: "get the logbook of a car for a year", Role: roleAnyone, Query: true, handler: (*CRUD).getLogbook,
+			Args: []ArgSpec{pathArg("carId"), {Name: "year", In: inQuery, Type: argInteger}}},
+
+		//ODOMETER
+		{Name: "getOdometerRules", Method: "get", Path: "/odometer/rules", result: OdometerRules{}, Description: "get the plausibility rules for the km", Role: roleAnyone, Query: true, handler: (*CRUD).getOdometerRules},
+		{Name: "setOdometerRules", Method: "put", Path: "/odometer/rules", Description: "set the plausibility rules for the km", Role: roleAdmin, handler: (*CRUD).setOdometerRules,
+			Args: []ArgSpec{bodyArg("rules", argJSON, objectBody(OdometerRules{}))}},
+		{Name: "getOdometerCorrections", Method: "get", Path: "/odometer/corrections/{carId}", result: []OdometerCorrection{}, Description: "get the km corrections of a car", Role: roleAnyone, Query: true, handler: (*CRUD).getOdometerCorrections,
+			Args: []ArgSpec{pathArg("carId")}},
+		{Name: "recordOdometerReplacement", Method: "put", Path: "/odometer/replacement/{carId}", result: OdometerOffset{}, Description: "record a replaced odometer of a car", Role: roleAdmin, handler: (*CRUD).recordOdometerReplacement,
+			Args: []ArgSpec{pathArg("carId"), bodyArg("replacement", argJSON, objectBody(CheckOdometerReplacementParameter{}, "newKm", "reason"))}},
+		{Name: "getCarOdometer", Method: "get", Path: "/odometer/cars/{carId}", result: CarOdometer{}, Description: "get the km of a car since it was new", Role: roleAnyone, Query: true, handler: (*CRUD).getCarOdometer,
+			Args: []ArgSpec{pathArg("carId")}},
+
+		//TELEMETRY
+		{Name: "registerDevice", Method: "put", Path: "/devices/{deviceId}", result: TelematicsDevice{}, Description: "register a telematics box for a car", Role: roleAdmin, handler: (*CRUD).registerDevice,
+			Args: []ArgSpec{pathArg("deviceId"), bodyArg("carId", argInteger, nil)}},
+		{Name: "deleteDevice", Method: "delete", Path: "/devices/{deviceId}", Description: "delete a telematics box - its readings stay", Role: roleAdmin, handler: (*CRUD).deleteDevice,
+			Args: []ArgSpec{pathArg("deviceId")}},
+		{Name: "recordTelemetry", Method: "post", Path: "/telemetry", result: OdometerReading{}, Description: "a registered telematics box records a reading of its car", Role: roleAnyone, handler: (*CRUD).recordTelemetry,
+			Args: []ArgSpec{bodyArg("reading", argJSON, objectBody(CheckTelemetryParameter{}, "km", "readAt"))}},
+		{Name: "getTelemetry", Method: "get", Path: "/telemetry/{carId}", result: []OdometerReading{}, Description: "get the telemetry readings of a car", Role: roleAnyone, Query: true, handler: (*CRUD).getTelemetry,
+			Args: []ArgSpec{pathArg("carId")}},
+
+		//NFC
+		{Name: "registerNfcCard", Method: "put", Path: "/nfc/cards/{cardId}", result: NfcCard{}, Description: "register the NFC card of a user with its public key", Role: roleAdmin, handler: (*CRUD).registerNfcCard,
+			Args: []ArgSpec{pathArg("cardId"), bodyArg("card", argJSON, objectBody(CheckNfcCardParameter{}, "userId", "publicKey"))}},
+		{Name: "revokeNfcCard", Method: "delete", Path: "/nfc/cards/{cardId}", result: NfcCard{}, Description: "revoke a lost NFC card", Role: roleAdmin, handler: (*CRUD).revokeNfcCard,
+			Args: []ArgSpec{pathArg("cardId")}},
+		{Name: "requestNfcChallenge", Method: "post", Path: "/nfc/challenge/{carId}", result: NfcChallenge{}, Description: "the reader of a car gets a nonce for the card to sign", Role: roleAnyone, handler: (*CRUD).requestNfcChallenge,
+			Args: []ArgSpec{pathArg("carId"), {Name: "action", In: inQuery, Type: argString}}},
+		{Name: "nfcBorrow", Method: "post", Path: "/nfcBorrow/{carId}", Description: "the user of a card borrows a car by nfc", Role: roleAnyone, handler: (*CRUD).nfcBorrow,
+			Args: []ArgSpec{pathArg("carId"), bodyArg("response", argJSON, objectBody(CheckNfcParameter{}, "cardId", "nonce", "signature"))}},
+		{Name: "nfcReturn", Method: "post", Path: "/nfcReturn/{carId}", Description: "the user of a card returns a car by nfc", Role: roleAnyone, handler: (*CRUD).nfcReturn,
+			Args: []ArgSpec{pathArg("carId"), bodyArg("response", argJSON, objectBody(CheckNfcParameter{}, "cardId", "nonce", "signature"))}},
+
+		//QR
+		{Name: "issueQrToken", Method: "post", Path: "/qr/token/{carId}", result: QrToken{}, Description: "an admin or the display of a car issues a QR token for the car - the secret is in the transient map", Role: roleAnyone, handler: (*CRUD).issueQrToken,
+			Args: []ArgSpec{pathArg("carId")}},
+		{Name: "qrBorrow", Method: "put", Path: "/qr/borrow", Description: "the caller borrows the car of a QR token - the secret is in the transient map", Role: roleAnyone, handler: (*CRUD).qrBorrow,
+			Args: []ArgSpec{{Name: "borrow", In: inBody, Type: argJSON, Optional: true, Schema: objectBody(CheckQrBorrowParameter{}), MaxSize: maxBodySize}}},
+		{Name: "qrReturn", Method: "put", Path: "/qr/return", Description: "the caller returns the car of a QR token and a travelLog is written - the secret is in the transient map", Role: roleAnyone, handler: (*CRUD).qrReturn,
+			Args: []ArgSpec{bodyArg("return", argJSON, objectBody(CheckReturnCarParameter{}, "newKm", "usage"))}},
+
+		//KEYS
+		{Name: "registerKey", Method: "put", Path: "/keys/{carId}/{keyId}", result: PhysicalKey{}, Description: "register a physical key of a car - it starts in the cabinet", Role: roleAdmin, handler: (*CRUD).registerKey,
+			Args: []ArgSpec{pathArg("carId"), pathArg("keyId")}},
+		{Name: "handOverKey", Method: "post", Path: "/keys/{carId}/{keyId}/handover", result: KeyEvent{}, Description: "record a handover of a key between cabinet, driver and staff", Role: roleAnyone, handler: (*CRUD).handOverKey,
+			Args: []ArgSpec{pathArg("carId"), pathArg("keyId"), bodyArg("handover", argJSON, objectBody(CheckKeyHandoverParameter{}, "to"))}},
+		{Name: "getKeys", Method: "get", Path: "/keys/cars/{carId}", result: []PhysicalKey{}, Description: "get the keys of a car with their holder", Role: roleAnyone, Query: true, handler: (*CRUD).getKeys,
+			Args: []ArgSpec{pathArg("carId")}},
+		{Name: "getKeyEvents", Method: "get", Path: "/keys/{carId}/{keyId}/events", result: []KeyEvent{}, Description: "get the handovers of a key", Role: roleAnyone, Query: true, handler: (*CRUD).getKeyEvents,
+			Args: []ArgSpec{pathArg("carId"), pathArg("keyId")}},
+
+		//CHECKLIST
+		{Name: "setChecklistTemplate", Method: "put", Path: "/checklists/{category}", result: ChecklistTemplate{}, Description: "set the checklist of a car category", Role: roleAdmin, handler: (*CRUD).setChecklistTemplate,
+			Args: []ArgSpec{{Name: "category", In: inPath, Type: argString}, bodyArg("checklist", argJSON, objectBody(CheckChecklistTemplateParameter{}, "items"))}},
+		{Name: "getChecklistTemplate", Method: "get", Path: "/checklists/{category}", result: ChecklistTemplate{}, Description: "get the checklist of a car category", Role: roleAnyone, Query: true, handler: (*CRUD).getChecklistTemplate,
+			Args: []ArgSpec{{Name: "category", In: inPath, Type: argString}}},
+
+		//ADMINISTRATION
+		{Name: "getBorrowLogById", Method: "get", Path: "/borrowLog/{id}", result: CarBorrow{}, Description: "get a borrow", Role: roleAnyone, Query: true, handler: (*CRUD).getBorrowLogById,
+			Args: []ArgSpec{pathArg("id")}},
+		{Name: "getTravelLogById", Method: "get", Path: "/travelLog/{id}", result: TravelLog{}, Description: "get a travelLog", Role: roleAnyone, Query: true, handler: (*CRUD).getTravelLogById,
+			Args: []ArgSpec{pathArg("id")}},
+		{Name: "getAllBorrowLogs", Method: "get", Path: "/borrowLogs", result: []CarBorrow{}, Description: "get all borrows", Role: roleAnyone, Query: true, handler: (*CRUD).getAllBorrowLogs},
+		{Name: "getAllTravelLogs", Method: "get", Path: "/travelLogs", result: []TravelLog{}, Description: "get all travelLogs", Role: roleAnyone, Query: true, handler: (*CRUD).getAllTravelLogs},
+		{Name: "getConsolidatedReport", Method: "get", Path: "/reports/{function}", result: []TenantResult{}, Description: "run a query for every tenant - args are the args of the query", Role: roleAuditor, Query: true, handler: (*CRUD).getConsolidatedReport,
+			Args: []ArgSpec{{Name: "function", In: inPath, Type: argString}, {Name: "args", In: inQuery, Type: argJSON, Optional: true, Schema: &BodySchema{Type: "array", Items: argString}, MaxSize: maxBodySize}}},
+		{Name: "listFunctions", Method: "get", Path: "/functions", result: []FunctionSpec{}, Description: "get every function of the chaincode with its arguments", Role: roleAnyone, Query: true, handler: (*CRUD).listFunctions},
+		{Name: "getOpenAPI", Method: "get", Path: "/openapi", result: map[string]interface{}{}, Description: "get the OpenAPI 3 document of every function", Role: roleAnyone, Query: true, handler: (*CRUD).getOpenAPI},
+
+		//TESTING
+		{Name: "getAllKeys", Method: "get", Path: "/allKeys", result: map[string]interface{}{}, Description: "get every key of the ledger", Role: roleAdmin, Query: true, handler: (*CRUD).getAllKeys},
+		{Name: "getAllValues", Method: "get", Path: "/allValues", result: []interface{}{}, Description: "get every value of the ledger", Role: roleAdmin, Query: true, handler: (*CRUD).getAllValues},
+		{Name: "getAllData", Method: "get", Path: "/allData", result: []LedgerEntry{}, Description: "get every key and value of the ledger", Role: roleAdmin, Query: true, handler: (*CRUD).getAllData},
+		{Name: "exportLedger", Method: "get", Path: "/ledger/export", result: LedgerExport{}, Description: "export one page of the ledger", Role: roleAdmin, Query: true, handler: (*CRUD).exportLedger,
+			Args: []ArgSpec{queryArg("pageSize", argInteger), queryArg("bookmark", argString)}},
+		{Name: "importLedger", Method: "post", Path: "/ledger/import", result: ImportStatus{}, Description: "import one page of exportLedger into a fresh ledger", Role: roleAdmin, handler: (*CRUD).importLedger,
+			Args: []ArgSpec{bulkBodyArg("page", argJSON, objectBody(LedgerExport{}, "format", "version", "entries"))}},
+		{Name: "exportUserPII", Method: "get", Path: "/ledger/export/pii", result: []CheckBulkUserPIIParameter{}, Description: "export the personal data of the private data collection", Role: roleAdmin, Query: true, handler: (*CRUD).exportUserPII},
+		{Name: "importUserPII", Method: "post", Path: "/ledger/import/pii", result: BulkResult{}, Description: "import the personal data of exportUserPII after the last page of importLedger", Role: roleAdmin, handler: (*CRUD).importUserPII},
+		{Name: "migrateRecords", Method: "post", Path: "/ledger/migrate", result: MigrationResult{}, Description: "upgrade a batch of old records to the current schema", Role: roleAdmin, handler: (*CRUD).migrateRecords,
+			Args: []ArgSpec{queryArg("batchSize", argInteger), queryArg("startKey", argString)}},
+	}
+
+	//the names are not case sensitive, like they were in the old switch of Invoke
+	functionsByName = map[string]*FunctionSpec{}
+	for i := range functionRegistry {
+		if functionRegistry[i].result != nil {
+			functionRegistry[i].Returns = modelName(reflect.TypeOf(functionRegistry[i].result))
+		}
+		functionsByName[strings.ToLower(functionRegistry[i].Name)] = &functionRegistry[i]
+	}
+}
+
+//=====================================VALIDATION=============================================
+
+//checkArgs checks the arguments against the spec of the function and fills up the left out optional ones
+func checkArgs(spec *FunctionSpec, args []string) ([]string, peer.Response, bool) {
+	required := 0
+	for i, arg := range spec.Args {
+		if !arg.Optional {
+			required = i + 1
+		}
+	}
+	if len(args) < required || len(args) > len(spec.Args) {
+		return nil, Error(http.StatusBadRequest, codeParameterMismatch, spec.Name+" needs "+argCount(required, len(spec.Args))+" but got "+strconv.Itoa(len(args))), false
+	}
+
+	filled := make([]string, len(spec.Args))
+	copy(filled, args)
+
+	//a body that is too big is not even looked at
+	for i, arg := range spec.Args {
+		if arg.MaxSize == 0 {
+			continue
+		}
+		if details := checkBodySize(arg.Name, filled[i], arg.MaxSize); len(details) != 0 {
+			return nil, Error(http.StatusRequestEntityTooLarge, codeTooLarge, "the body is too large", details...), false
+		}
+	}
+
+	details := []FieldError{}
+	for i, arg := range spec.Args {
+		//the handler gets an escaped JSON body as plain JSON
+		if arg.Type == argJSON {
+			filled[i] = unescapeBody(filled[i])
+		}
+		if filled[i] == "" {
+			if !arg.Optional && arg.Type != argString {
+				details = append(details, fieldError(arg.Name, "cant be empty"))
+			}
+			continue
+		}
+		details = append(details, checkArg(arg, filled[i])...)
+	}
+	if len(details) != 0 {
+		code := codeInvalidParameter
+		for _, detail := range details {
+			if strings.HasPrefix(detail.Message, msgNoJSON) {
+				code = codeInvalidJSON
+			}
+		}
+		return nil, Error(http.StatusBadRequest, code, "one parameter is wrong!", details...), false
+	}
+	return filled, peer.Response{}, true
+}
+
+func argCount(min int, max int) string {
+	if min == max {
+		return strconv.Itoa(min) + " arguments"
+	}
+	return strconv.Itoa(min) + " to " + strconv.Itoa(max) + " arguments"
+}
+
+//checkArg returns what is wrong with one argument
+func checkArg(arg ArgSpec, value string) []FieldError {
+	switch arg.Type {
+	case argInteger:
+		if _, err := strconv.Atoi(value); err != nil {
+			return []FieldError{fieldError(arg.Name, "has to be an integer")}
+		}
+	case argNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return []FieldError{fieldError(arg.Name, "has to be a number")}
+		}
+	case argBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return []FieldError{fieldError(arg.Name, "has to be true or false")}
+		}
+	case argJSON:
+		return checkBody(arg.Name, arg.Schema, value)
+	}
+	return nil
+}
+
+//checkBody checks the type of a JSON body and if the required fields are there
+//the types of the fields are checked by the handler when it decodes the body
+func checkBody(name string, schema *BodySchema, value string) []FieldError {
+	body := []byte(value)
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		_, details := decodeErrorFields(name, err)
+		return details
+	}
+	if schema == nil {
+		return nil
+	}
+
+	switch schema.Type {
+	case "object":
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+			return []FieldError{fieldError(name, "has to be a JSON object")}
+		}
+		details := []FieldError{}
+		for _, field := range schema.Required {
+			if _, found := fields[field]; !found {
+				details = append(details, fieldError(field, "is required"))
+			}
+		}
+		return details
+	case "array":
+		var entries []json.RawMessage
+		if err := json.Unmarshal(body, &entries); err != nil || entries == nil {
+			return []FieldError{fieldError(name, "has to be a JSON array")}
+		}
+		if schema.Items == argInteger {
+			for i, entry := range entries {
+				var number int
+				if err := json.Unmarshal(entry, &number); err != nil {
+					return []FieldError{fieldError(name+"["+strconv.Itoa(i)+"]", "has to be an integer")}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//checkRole is true if the caller is allowed to call the function at all
+//a handler can still check more, e.g. updateCar needs an admin only for a km correction
+func checkRole(stub shim.ChaincodeStubInterface, spec *FunctionSpec) bool {
+	if spec.Role == roleAdmin {
+		return isAdmin(stub)
+	}
+	if spec.Role == roleAuditor {
+		return isAuditor(stub)
+	}
+	return true
+}
+
+//=====================================LIST FUNCTIONS=========================================
+func (cc *CRUD) listFunctions(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+
+	functions := make([]FunctionSpec, len(functionRegistry))
+	copy(functions, functionRegistry)
+	sort.Slice(functions, func(i, j int) bool { return functions[i].Name < functions[j].Name })
+	for i := range functions {
+		if functions[i].Args == nil {
+			functions[i].Args = []ArgSpec{}
+		}
+	}
+
+	functionsAsBytes, _ := json.Marshal(functions)
+	return Success(http.StatusOK, "OK", functionsAsBytes)
+}
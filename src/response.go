@@ -0,0 +1,133 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//======================================================================================== RESPONSE
+package main
+
+import (
+	"encoding/json"
+)
+
+//every answer of the chaincode is an Envelope in the payload - the one of Success and the one of Error
+//Code is "OK" or one of the error codes below, a client has to check Code and not Message
+//Data is the JSON answer of a function, a text answer is a JSON string
+type Envelope struct {
+	Status  int32           `json:"status"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Details []FieldError    `json:"details,omitempty"`
+}
+
+//one wrong field of a request - Field is the json name, e.g. "km" or "location.siteId"
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+//the error codes are stable - the texts of the messages can change, these never do
+//a new code can be added, but an existing one is never renamed or used for something else
+const (
+	codeOK = "OK"
+
+	//the request itself
+	codeUnknownFunction   = "UNKNOWN_FUNCTION"
+	codeParameterMismatch = "PARAMETER_MISMATCH"
+	codeInvalidJSON       = "INVALID_JSON"
+	codeInvalidParameter  = "INVALID_PARAMETER"
+	codeIdMismatch        = "ID_MISMATCH"
+	codeInvalidLocation   = "INVALID_LOCATION"
+	codeTooLarge          = "PAYLOAD_TOO_LARGE"
+
+	//who is calling
+	codeAdminRequired   = "ADMIN_REQUIRED"
+	codeAuditorRequired = "AUDITOR_REQUIRED"
+	codeCallerUnknown   = "CALLER_UNKNOWN"
+
+	//records that dont exist or already exist
+	codeCarNotFound          = "CAR_NOT_FOUND"
+	codeUserNotFound         = "USER_NOT_FOUND"
+	codeBorrowNotFound       = "BORROW_NOT_FOUND"
+	codeTravelLogNotFound    = "TRAVELLOG_NOT_FOUND"
+	codePoolNotFound         = "POOL_NOT_FOUND"
+	codeReservationNotFound  = "RESERVATION_NOT_FOUND"
+	codeMaintenanceNotFound  = "MAINTENANCE_NOT_FOUND"
+	codeDeviceNotFound       = "DEVICE_NOT_FOUND"
+	codeNfcCardNotFound      = "NFC_CARD_NOT_FOUND"
+	codeKeyNotFound          = "KEY_NOT_FOUND"
+	codePIINotFound          = "PERSONAL_DATA_NOT_FOUND"
+	codeCarAlreadyExists     = "CAR_ALREADY_EXISTS"
+	codeCarHasHistory        = "CAR_HAS_HISTORY"
+	codeUserAlreadyExists    = "USER_ALREADY_EXISTS"
+	codeSiteAlreadyExists    = "SITE_ALREADY_EXISTS"
+	codePoolAlreadyExists    = "POOL_ALREADY_EXISTS"
+	codeNfcCardAlreadyExists = "NFC_CARD_ALREADY_EXISTS"
+	codeKeyAlreadyExists     = "KEY_ALREADY_EXISTS"
+	codeUserErased           = "USER_ERASED"
+	codeInvalidPersonalData  = "INVALID_PERSONAL_DATA"
+
+	//borrow and return
+	codeCarAlreadyBorrowed   = "CAR_ALREADY_BORROWED"
+	codeUserAlreadyBorrowing = "USER_ALREADY_BORROWING"
+	codeUserNotBorrowing     = "USER_NOT_BORROWING"
+	codeBorrowMismatch       = "BORROW_MISMATCH"
+	codeLicenceInvalid       = "LICENCE_INVALID"
+	codeNotEntitled          = "NOT_ENTITLED"
+	codeCarNotAvailable      = "CAR_NOT_AVAILABLE"
+	codeReservationCancelled = "RESERVATION_CANCELLED"
+	codeNfcRejected          = "NFC_REJECTED"
+	codeQrRejected           = "QR_REJECTED"
+	codeKeyHandover          = "KEY_HANDOVER_INVALID"
+	codeChecklistIncomplete  = "CHECKLIST_INCOMPLETE"
+	codeChecklistFailed      = "CHECKLIST_FAILED"
+
+	//km, odometer and logbook
+	codeInvalidKm           = "INVALID_KM"
+	codeOdometerGap         = "ODOMETER_GAP"
+	codeKmMismatch          = "KM_MISMATCH"
+	codeLogbookViolation    = "LOGBOOK_VIOLATION"
+	codeLogbookModeRequired = "LOGBOOK_MODE"
+	codeCorrectionReason    = "CORRECTION_REASON_REQUIRED"
+
+	//bulk import, ledger import and migration
+	codeInvalidRows          = "INVALID_ROWS"
+	codeInvalidExport        = "INVALID_EXPORT"
+	codeLedgerNotFresh       = "LEDGER_NOT_FRESH"
+	codeImportOrder          = "IMPORT_ORDER"
+	codeImportDone           = "IMPORT_DONE"
+	codeReferentialIntegrity = "REFERENTIAL_INTEGRITY"
+
+	codeInternal = "INTERNAL_ERROR"
+)
+
+//jsonData makes a JSON value of a payload - JSON stays as it is and a text becomes a JSON string
+func jsonData(payload []byte) json.RawMessage {
+	if payload == nil {
+		return nil
+	}
+	if json.Valid(payload) {
+		return json.RawMessage(payload)
+	}
+	text, _ := json.Marshal(string(payload))
+	return json.RawMessage(text)
+}
+
+func envelope(rc int32, code string, doc string, payload []byte, details []FieldError) []byte {
+	envelopeAsBytes, _ := json.Marshal(Envelope{
+		Status:  rc,
+		Code:    code,
+		Message: doc,
+		Data:    jsonData(payload),
+		Details: details,
+	})
+	return envelopeAsBytes
+}
+
+//fieldError is a shortcut for one FieldError
+func fieldError(field string, message string) FieldError {
+	return FieldError{Field: field, Message: message}
+}
@@ -0,0 +1,442 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//================================================================================== SCHEMA VERSION
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//every document in the ledger has a schemaVersion - a record without one is version 0 (written before this existed)
+//if a struct changes in a way old records cant be decoded anymore, its version goes up and an upgrade step is added
+const (
+	schemaVersionCar                = 1
+	schemaVersionUser               = 1
+	schemaVersionBorrow             = 1
+	schemaVersionTravelLog          = 1
+	schemaVersionSite               = 1
+	schemaVersionPool               = 1
+	schemaVersionLogbook            = 1
+	schemaVersionOdometerRules      = 1
+	schemaVersionOdometerCorrection = 1
+	schemaVersionOdometerOffset     = 1
+	schemaVersionUsageStats         = 1
+	schemaVersionUserPII            = 1
+	schemaVersionImportStatus       = 1
+	schemaVersionReservation        = 1
+	schemaVersionMaintenance        = 1
+	schemaVersionDevice             = 1
+	schemaVersionOdometerReading    = 1
+	schemaVersionCarDevice          = 1
+	schemaVersionNfcCard            = 1
+	schemaVersionNfcChallenge       = 1
+	schemaVersionQrToken            = 1
+	schemaVersionPhysicalKey        = 1
+	schemaVersionKeyEvent           = 1
+	schemaVersionChecklist          = 1
+)
+
+//migrateRecords cant rewrite the whole ledger in one transaction
+const (
+	defaultMigrationBatchSize = 100
+	maxMigrationBatchSize     = 500
+)
+
+//an upgrade step changes the fields of a document of one version to the next version
+type upgradeStep func(fields map[string]json.RawMessage) error
+
+//version 0 users had their name in the public state, since version 1 it is in the private data collection
+//the name is just dropped here - migrateRecords moves it to the collection before
+var userUpgrades = map[int]upgradeStep{
+	0: func(fields map[string]json.RawMessage) error {
+		delete(fields, "name")
+		return nil
+	},
+}
+
+//documentSchema is how a struct is stored - its current version and the steps from the older ones
+//fields is the same struct without MarshalJSON and UnmarshalJSON, so json does not call them again
+type documentSchema struct {
+	document interface{}
+	version  int
+	upgrades map[int]upgradeStep
+	fields   reflect.Type
+}
+
+//every stored struct by its type of exportLedger/entityTypeOfKey
+//userPII (private data) and importStatus are no entity type, migrateRecords never finds them
+var documentSchemas = map[string]*documentSchema{
+	"car":           {document: Car{}, version: schemaVersionCar},
+	"user":          {document: User{}, version: schemaVersionUser, upgrades: userUpgrades},
+	"borrow":        {document: CarBorrow{}, version: schemaVersionBorrow},
+	"travelLog":     {document: TravelLog{}, version: schemaVersionTravelLog},
+	"site":          {document: Site{}, version: schemaVersionSite},
+	"pool":          {document: Pool{}, version: schemaVersionPool},
+	"logbook":       {document: Logbook{}, version: schemaVersionLogbook},
+	"config":        {document: OdometerRules{}, version: schemaVersionOdometerRules},
+	"odoCorrection": {document: OdometerCorrection{}, version: schemaVersionOdometerCorrection},
+	"odoOffset":     {document: OdometerOffset{}, version: schemaVersionOdometerOffset},
+	"stats":         {document: UsageStats{}, version: schemaVersionUsageStats},
+	"userPII":       {document: UserPII{}, version: schemaVersionUserPII},
+	"importStatus":  {document: ImportStatus{}, version: schemaVersionImportStatus},
+	"reservation":   {document: Reservation{}, version: schemaVersionReservation},
+	"maintenance":   {document: MaintenanceBlock{}, version: schemaVersionMaintenance},
+	"device":        {document: TelematicsDevice{}, version: schemaVersionDevice},
+	"odoReading":    {document: OdometerReading{}, version: schemaVersionOdometerReading},
+	"carDevice":     {document: CarDevice{}, version: schemaVersionCarDevice},
+	"nfcCard":       {document: NfcCard{}, version: schemaVersionNfcCard},
+	"nfcNonce":      {document: NfcChallenge{}, version: schemaVersionNfcChallenge},
+	"qrToken":       {document: QrToken{}, version: schemaVersionQrToken},
+	"physKey":       {document: PhysicalKey{}, version: schemaVersionPhysicalKey},
+	"keyEvent":      {document: KeyEvent{}, version: schemaVersionKeyEvent},
+	"checklist":     {document: ChecklistTemplate{}, version: schemaVersionChecklist},
+}
+
+//the same schemas by the go type of the document
+var documentSchemaOfType = map[reflect.Type]*documentSchema{}
+
+func init() {
+	for _, stored := range documentSchemas {
+		t := reflect.TypeOf(stored.document)
+		fields := make([]reflect.StructField, t.NumField())
+		for i := range fields {
+			fields[i] = t.Field(i)
+		}
+		stored.fields = reflect.StructOf(fields)
+		documentSchemaOfType[t] = stored
+	}
+}
+
+//the types that are written once - checkLoggedTrip counts every write of a travelLog as a modification
+//migrateRecords leaves them alone, they are upgraded on every read instead
+var writeOnceTypes = map[string]bool{"travelLog": true}
+
+//newDocument returns an empty document of a type to decode a record into - nil if the type has no schema
+func newDocument(entityType string) interface{} {
+	stored, found := documentSchemas[entityType]
+	if !found {
+		return nil
+	}
+	return reflect.New(reflect.TypeOf(stored.document)).Interface()
+}
+
+//this one is just the answer of migrateRecords - NextKey is "" if every record was checked
+type MigrationResult struct {
+	Scanned  int                `json:"scanned"`
+	Migrated int                `json:"migrated"`
+	Failed   []ImportEntryError `json:"failed"`
+	NextKey  string             `json:"nextKey"`
+}
+
+//readSchemaVersion is the schemaVersion of a stored document - 0 if it has none
+func readSchemaVersion(data []byte) (int, error) {
+	var document struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return 0, err
+	}
+	return document.SchemaVersion, nil
+}
+
+//upgradeDocument brings a document of an older version to the current one
+//a document of a newer version was written by a newer chaincode and cant be read
+func upgradeDocument(data []byte, current int, steps map[int]upgradeStep) ([]byte, error) {
+
+	version, err := readSchemaVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	if version == current {
+		return data, nil
+	}
+	if version > current {
+		return nil, errors.New("schemaVersion " + strconv.Itoa(version) + " is newer than " + strconv.Itoa(current) + " of this chaincode")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for ; version < current; version++ {
+		if step, found := steps[version]; found {
+			if err := step(fields); err != nil {
+				return nil, err
+			}
+		}
+	}
+	fields["schemaVersion"] = json.RawMessage(strconv.Itoa(current))
+	return json.Marshal(fields)
+}
+
+//decodeDocument is the upgrade-on-read of every stored struct - target is the struct without its UnmarshalJSON
+func decodeDocument(data []byte, current int, steps map[int]upgradeStep, target interface{}) error {
+	upgraded, err := upgradeDocument(data, current, steps)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(upgraded, target)
+}
+
+//decodeStrictDocument is the upgrade of unmarshalDocument with decodeStrict - importLedger uses it
+func decodeStrictDocument(data []byte, document interface{}) error {
+	stored := documentSchemaOfType[reflect.TypeOf(document).Elem()]
+	upgraded, err := upgradeDocument(data, stored.version, stored.upgrades)
+	if err != nil {
+		return err
+	}
+	return decodeStrict(upgraded, documentFields(document))
+}
+
+//documentFields is a pointer to a document as the fields of its schema - the same memory without the json methods
+//decodeBody uses it, so a body is decoded strictly and not upgraded
+func documentFields(document interface{}) interface{} {
+	value := reflect.ValueOf(document)
+	stored := documentSchemaOfType[value.Type().Elem()]
+	return value.Convert(reflect.PtrTo(stored.fields)).Interface()
+}
+
+//marshalDocument is the MarshalJSON of every stored struct - it always writes the current schemaVersion
+func marshalDocument(document interface{}) ([]byte, error) {
+	value := reflect.New(reflect.TypeOf(document))
+	value.Elem().Set(reflect.ValueOf(document))
+	stored := documentSchemaOfType[value.Type().Elem()]
+	value.Elem().FieldByName("SchemaVersion").SetInt(int64(stored.version))
+	return json.Marshal(documentFields(value.Interface()))
+}
+
+//unmarshalDocument is the UnmarshalJSON of every stored struct - it upgrades older documents
+func unmarshalDocument(data []byte, document interface{}) error {
+	stored := documentSchemaOfType[reflect.TypeOf(document).Elem()]
+	return decodeDocument(data, stored.version, stored.upgrades, documentFields(document))
+}
+
+//migrateLegacyName moves the name of a version 0 user from the public state to the private data collection
+//the salt is made from the secret of the transient map - one from the txId could be read from the block
+func migrateLegacyName(stub shim.ChaincodeStubInterface, key string, data []byte, user *User, secret string) error {
+
+	var legacy struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal(data, &legacy)
+	if legacy.Name == "" {
+		return nil
+	}
+
+	pii, err := getUserPIIOfUser(stub, user.Id)
+	if err != nil {
+		return err
+	}
+	if pii != nil {
+		return nil
+	}
+	return putUserPII(stub, user, UserPII{Name: legacy.Name, Salt: saltedHash(secret, key)})
+}
+
+//upgradedDocument is a stored record in the current schemaVersion for an answer
+//a record that cant be decoded is answered as it is
+func upgradedDocument(entityType string, data []byte) []byte {
+	document := newDocument(entityType)
+	if document == nil || json.Unmarshal(data, document) != nil {
+		return data
+	}
+	documentAsBytes, err := json.Marshal(document)
+	if err != nil {
+		return data
+	}
+	return documentAsBytes
+}
+
+//=====================================MIGRATE RECORDS========================================
+func (cc *CRUD) migrateRecords(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(query) -> args[0]: "batchSize" - "" is 100
+	//(query) -> args[1]: "startKey" - "" is the first key, then the nextKey of the batch before
+	//every record of an older schemaVersion is written again with the current one - but not a travelLog, see writeOnceTypes
+	//the personal data in the private data collection is upgraded on read and written new on its next change
+	//(transient) -> "salt": the secret the salts of old users with a plain name are made from - only needed if there is one
+
+	batchSize := defaultMigrationBatchSize
+	if args[0] != "" {
+		overgivenBatchSize, err := strconv.Atoi(args[0])
+		if err != nil || overgivenBatchSize < 1 || overgivenBatchSize > maxMigrationBatchSize {
+			return Error(http.StatusBadRequest, codeInvalidParameter, "batchSize has to be between 1 and "+strconv.Itoa(maxMigrationBatchSize))
+		}
+		batchSize = overgivenBatchSize
+	}
+
+	resultsIterator, err := stub.GetStateByRange(args[1], "")
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	result := MigrationResult{Failed: []ImportEntryError{}}
+	secret := ""
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		//one more than the batch is read to know where the next batch starts
+		if result.Scanned == batchSize {
+			result.NextKey = it.Key
+			break
+		}
+		result.Scanned += 1
+
+		entityType := entityTypeOfKey(it.Key)
+		stored, found := documentSchemas[entityType]
+		if !found || writeOnceTypes[entityType] {
+			continue
+		}
+		version, err := readSchemaVersion(it.Value)
+		if err != nil {
+			result.Failed = append(result.Failed, ImportEntryError{Entry: result.Scanned, Key: it.Key, Error: err.Error()})
+			continue
+		}
+		if version == stored.version {
+			continue
+		}
+
+		document := newDocument(entityType)
+		if err := json.Unmarshal(it.Value, document); err != nil {
+			result.Failed = append(result.Failed, ImportEntryError{Entry: result.Scanned, Key: it.Key, Error: err.Error()})
+			continue
+		}
+		if user, isUser := document.(*User); isUser && version == 0 && hasNameField(it.Value) {
+			if secret == "" {
+				var response peer.Response
+				var ok bool
+				if secret, response, ok = readTransientSalt(stub); !ok {
+					return response
+				}
+			}
+			if err := migrateLegacyName(stub, it.Key, it.Value, user, secret); err != nil {
+				return Error(http.StatusInternalServerError, codeInternal, err.Error())
+			}
+		}
+
+		documentAsBytes, _ := json.Marshal(document)
+		if err := stub.PutState(it.Key, documentAsBytes); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		result.Migrated += 1
+	}
+
+	stub.SetEvent("Records migrated", []byte("scanned: "+strconv.Itoa(result.Scanned)+" migrated: "+strconv.Itoa(result.Migrated)))
+	resultAsBytes, _ := json.Marshal(result)
+	return Success(http.StatusOK, "OK", resultAsBytes)
+}
+
+//=====================================SCHEMA OF THE STRUCTS==================================
+//every stored struct needs its own MarshalJSON and UnmarshalJSON for json to find them - the work is done by documentSchemas
+
+func (car Car) MarshalJSON() ([]byte, error)     { return marshalDocument(car) }
+func (car *Car) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, car) }
+
+func (user User) MarshalJSON() ([]byte, error)     { return marshalDocument(user) }
+func (user *User) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, user) }
+
+func (carBorrow CarBorrow) MarshalJSON() ([]byte, error) { return marshalDocument(carBorrow) }
+func (carBorrow *CarBorrow) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, carBorrow)
+}
+
+func (travelLog TravelLog) MarshalJSON() ([]byte, error) { return marshalDocument(travelLog) }
+func (travelLog *TravelLog) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, travelLog)
+}
+
+func (site Site) MarshalJSON() ([]byte, error)     { return marshalDocument(site) }
+func (site *Site) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, site) }
+
+func (pool Pool) MarshalJSON() ([]byte, error)     { return marshalDocument(pool) }
+func (pool *Pool) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, pool) }
+
+func (logbook Logbook) MarshalJSON() ([]byte, error)     { return marshalDocument(logbook) }
+func (logbook *Logbook) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, logbook) }
+
+func (rules OdometerRules) MarshalJSON() ([]byte, error)     { return marshalDocument(rules) }
+func (rules *OdometerRules) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, rules) }
+
+func (correction OdometerCorrection) MarshalJSON() ([]byte, error) {
+	return marshalDocument(correction)
+}
+func (correction *OdometerCorrection) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, correction)
+}
+
+func (offset OdometerOffset) MarshalJSON() ([]byte, error) { return marshalDocument(offset) }
+func (offset *OdometerOffset) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, offset)
+}
+
+func (stats UsageStats) MarshalJSON() ([]byte, error)     { return marshalDocument(stats) }
+func (stats *UsageStats) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, stats) }
+
+func (pii UserPII) MarshalJSON() ([]byte, error)     { return marshalDocument(pii) }
+func (pii *UserPII) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, pii) }
+
+func (status ImportStatus) MarshalJSON() ([]byte, error)     { return marshalDocument(status) }
+func (status *ImportStatus) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, status) }
+
+func (reservation Reservation) MarshalJSON() ([]byte, error) { return marshalDocument(reservation) }
+func (reservation *Reservation) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, reservation)
+}
+
+func (maintenance MaintenanceBlock) MarshalJSON() ([]byte, error) {
+	return marshalDocument(maintenance)
+}
+func (maintenance *MaintenanceBlock) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, maintenance)
+}
+
+func (device TelematicsDevice) MarshalJSON() ([]byte, error) { return marshalDocument(device) }
+func (device *TelematicsDevice) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, device)
+}
+
+func (reading OdometerReading) MarshalJSON() ([]byte, error) { return marshalDocument(reading) }
+func (reading *OdometerReading) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, reading)
+}
+
+func (carDevice CarDevice) MarshalJSON() ([]byte, error) { return marshalDocument(carDevice) }
+func (carDevice *CarDevice) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, carDevice)
+}
+
+func (card NfcCard) MarshalJSON() ([]byte, error)     { return marshalDocument(card) }
+func (card *NfcCard) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, card) }
+
+func (challenge NfcChallenge) MarshalJSON() ([]byte, error) { return marshalDocument(challenge) }
+func (challenge *NfcChallenge) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, challenge)
+}
+
+func (qrToken QrToken) MarshalJSON() ([]byte, error)     { return marshalDocument(qrToken) }
+func (qrToken *QrToken) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, qrToken) }
+
+func (key PhysicalKey) MarshalJSON() ([]byte, error)     { return marshalDocument(key) }
+func (key *PhysicalKey) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, key) }
+
+func (event KeyEvent) MarshalJSON() ([]byte, error)     { return marshalDocument(event) }
+func (event *KeyEvent) UnmarshalJSON(data []byte) error { return unmarshalDocument(data, event) }
+
+func (template ChecklistTemplate) MarshalJSON() ([]byte, error) { return marshalDocument(template) }
+func (template *ChecklistTemplate) UnmarshalJSON(data []byte) error {
+	return unmarshalDocument(data, template)
+}
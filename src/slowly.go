@@ -9,13 +9,11 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/peer"
@@ -25,20 +23,33 @@ import (
 //================================================================================= RETURN HANDLING
 
 // Success HTTP 2xx with a payload
+// the payload is the data of the Envelope (see response.go)
 func Success(rc int32, doc string, payload []byte) peer.Response {
 	return peer.Response{
 		Status:  rc,
 		Message: doc,
-		Payload: payload,
+		Payload: envelope(rc, codeOK, doc, payload, nil),
 	}
 }
 
-// Error HTTP 4xx or 5xx with an error message
-func Error(rc int32, doc string) peer.Response {
-	logger.Errorf("Error %d = %s", rc, doc)
+//Error HTTP 4xx or 5xx with an error code, an error message and the wrong fields if there are some
+//the message starts with the code as well, for clients that dont get the payload of an error
+func Error(rc int32, code string, doc string, details ...FieldError) peer.Response {
+	logger.Errorf("Error %d %s = %s", rc, code, doc)
 	return peer.Response{
 		Status:  rc,
-		Message: doc,
+		Message: code + ": " + doc,
+		Payload: envelope(rc, code, doc, nil, details),
+	}
+}
+
+//ErrorWithData HTTP 4xx with a payload - e.g. all invalid rows of a bulk import
+func ErrorWithData(rc int32, code string, doc string, payload []byte) peer.Response {
+	logger.Errorf("Error %d %s = %s", rc, code, doc)
+	return peer.Response{
+		Status:  rc,
+		Message: code + ": " + doc,
+		Payload: envelope(rc, code, doc, payload, nil),
 	}
 }
 
@@ -46,51 +57,116 @@ func Error(rc int32, doc string) peer.Response {
 //======================================================================================= MAIN/INIT
 var logger = shim.NewLogger("chaincode")
 
+//every time in the ledger is written in this format
+const timeFormat = "2006-01-02 15:04:05"
+
 type CRUD struct {
 }
 
 // this is needed to create cars in the init func - this has nothing to do with the model definition in the yaml file
+// Location is where the car was dropped off the last time
+// Category is the licence class a driver needs for the car - empty is a normal car (B)
+// PoolId is the pool of the car - only an admin can change it with assignCarToPool
+// Seats, FuelType and RangeKm are what findAvailableCars looks at - 0 and "" are not known
+// Status is "active" or "inactive" - empty is active
+// OwnerOrg is the MSP ID of the org whose peers have to endorse every write of the car - only an admin can change it with transferCar
 type Car struct {
-	Id       int `json:"id"`
-	Km       int `json:"km"`
-	BorrowId int `json:"borrowId"`
+	Id            int      `json:"id"`
+	Km            int      `json:"km"`
+	BorrowId      int      `json:"borrowId"`
+	Location      Location `json:"location"`
+	Category      string   `json:"category"`
+	PoolId        int      `json:"poolId"`
+	Seats         int      `json:"seats"`
+	FuelType      string   `json:"fuelType"`
+	RangeKm       int      `json:"rangeKm"`
+	Status        string   `json:"status"`
+	OwnerOrg      string   `json:"ownerOrg"`
+	SchemaVersion int      `json:"schemaVersion"`
 }
 
+//the licence fields can only be changed by an admin with verifyLicence and the pools with setUserPools
+//the name is in the private data collection, the public ledger only knows the pseudonym and the salted hash of it
+//an erased user is just a tombstone with the pseudonym, see eraseUser
 type User struct {
-	Id       int    `json:"id"`
-	Name     string `json:"name"`
-	BorrowId int    `json:"borrowId"`
+	Id                int      `json:"id"`
+	Pseudonym         string   `json:"pseudonym"`
+	NameHash          string   `json:"nameHash"`
+	BorrowId          int      `json:"borrowId"`
+	LicenceClasses    []string `json:"licenceClasses"`
+	LicenceExpiry     string   `json:"licenceExpiry"`
+	LicenceVerified   string   `json:"licenceVerified"`
+	LicenceVerifiedBy string   `json:"licenceVerifiedBy"`
+	Pools             []int    `json:"pools"`
+	Erased            bool     `json:"erased"`
+	ErasedAt          string   `json:"erasedAt"`
+	SchemaVersion     int      `json:"schemaVersion"`
 }
 
 //this one will be written to the Ledger
+//OwnerOrg is the owner of the car when it was borrowed - his peers have to endorse the borrow (see endorsement.go)
 type CarBorrow struct {
-	Id        int    `json:"id"`
-	CarId     int    `json:"carId"`
-	UserId    int    `json:"userId"`
-	StartTime string `json:"startTime"`
+	Id              int               `json:"id"`
+	CarId           int               `json:"carId"`
+	UserId          int               `json:"userId"`
+	StartTime       string            `json:"startTime"`
+	PickupLocation  Location          `json:"pickupLocation"`
+	PickupChecklist []ChecklistAnswer `json:"pickupChecklist"`
+	OwnerOrg        string            `json:"ownerOrg"`
+	SchemaVersion   int               `json:"schemaVersion"`
 }
 
 //this one is just for internal Operations in func borrowACar
 type CheckBorrowCarParameter struct {
-	CarId int `json:"carId"`
+	CarId     int               `json:"carId"`
+	Location  Location          `json:"location"`
+	Checklist []ChecklistAnswer `json:"checklist"`
 }
 
 //this one is just for internal Operations in func returnACar
 type CheckReturnCarParameter struct {
-	NewKm int    `json:"newKm"`
-	Usage string `json:"usage"`
+	NewKm           int               `json:"newKm"`
+	Usage           string            `json:"usage"`
+	TripType        string            `json:"tripType"`
+	BusinessPartner string            `json:"businessPartner"`
+	Route           string            `json:"route"`
+	Location        Location          `json:"location"`
+	Checklist       []ChecklistAnswer `json:"checklist"`
 }
 
+//TripType, BusinessPartner and Route are what the german tax authority wants in a Fahrtenbuch
+//PrevLogId, PrevHash and Hash chain all travelLogs of a car, so a modification can be seen
+//KmOffset is the offset of a replaced odometer - StartKm + KmOffset are the km since the car was new
+//TelemetryKm is the newest reading of the telematics box at the return (0 if there was none), KmMismatch is set if EndKm is too far off
+//KeyNotReturned is set if the driver still held a physical key of the car at the return
+//PickupChecklist and DropoffChecklist are the answers of the driver to the checklist of the category of the car
+//ChecklistFailed are the mandatory checks of the return the driver answered with ok:false
 type TravelLog struct {
-	Id        int    `json:"id"`
-	UserId    int    `json:"userId"`
-	CarId     int    `json:"carId"`
-	Usage     string `json:"usage"`
-	StartKm   int    `json:"startKm"`
-	EndKm     int    `json:"endKm"`
-	DrivenKm  int    `json:"drivenKm"`
-	StartTime string `json:"startTime"`
-	EndTime   string `json:"endTime"`
+	Id               int               `json:"id"`
+	UserId           int               `json:"userId"`
+	CarId            int               `json:"carId"`
+	Usage            string            `json:"usage"`
+	TripType         string            `json:"tripType"`
+	BusinessPartner  string            `json:"businessPartner"`
+	Route            string            `json:"route"`
+	StartKm          int               `json:"startKm"`
+	EndKm            int               `json:"endKm"`
+	DrivenKm         int               `json:"drivenKm"`
+	StartTime        string            `json:"startTime"`
+	EndTime          string            `json:"endTime"`
+	PrevLogId        int               `json:"prevLogId"`
+	PrevHash         string            `json:"prevHash"`
+	Hash             string            `json:"hash"`
+	KmOffset         int               `json:"kmOffset"`
+	PickupLocation   Location          `json:"pickupLocation"`
+	DropoffLocation  Location          `json:"dropoffLocation"`
+	TelemetryKm      int               `json:"telemetryKm"`
+	KmMismatch       bool              `json:"kmMismatch"`
+	KeyNotReturned   bool              `json:"keyNotReturned"`
+	ChecklistFailed  []string          `json:"checklistFailed,omitempty"`
+	PickupChecklist  []ChecklistAnswer `json:"pickupChecklist"`
+	DropoffChecklist []ChecklistAnswer `json:"dropoffChecklist"`
+	SchemaVersion    int               `json:"schemaVersion"`
 }
 
 func main() {
@@ -100,29 +176,107 @@ func main() {
 	logger.SetLevel(shim.LogInfo)
 }
 
+//checkCarFields returns every field of an overgiven car that is wrong
+func checkCarFields(car Car) []FieldError {
+	details := []FieldError{}
+	if car.Id <= 0 {
+		details = append(details, fieldError("id", "has to be greater than 0"))
+	}
+	if car.Km <= 0 {
+		details = append(details, fieldError("km", "has to be greater than 0"))
+	}
+	if car.BorrowId != 0 {
+		details = append(details, fieldError("borrowId", "has to be 0"))
+	}
+	if car.Seats < 0 {
+		details = append(details, fieldError("seats", "cant be negative"))
+	}
+	if car.RangeKm < 0 {
+		details = append(details, fieldError("rangeKm", "cant be negative"))
+	}
+	if !fuelTypes[car.FuelType] {
+		details = append(details, fieldError("fuelType", "is no known fuel type"))
+	}
+	if car.Status != "" && car.Status != carStatusActive && car.Status != carStatusInactive {
+		details = append(details, fieldError("status", "has to be active or inactive"))
+	}
+	return details
+}
+
+//checkUserFields returns every field of an overgiven user that is wrong
+func checkUserFields(user User) []FieldError {
+	details := []FieldError{}
+	if user.Id <= 0 {
+		details = append(details, fieldError("id", "has to be greater than 0"))
+	}
+	if user.BorrowId != 0 {
+		details = append(details, fieldError("borrowId", "has to be 0"))
+	}
+	return details
+}
+
 //this func is called when smart contract get instantiated
 //init two cars automatically
+//the org that instantiates the chaincode is the home tenant, the args are the orgs of the auditors, e.g. ["Org9MSP"]
 func (cc *CRUD) Init(stub shim.ChaincodeStubInterface) peer.Response {
 
+	tenant, err := callerTenant(stub)
+	if err != nil {
+		return Error(http.StatusForbidden, codeCallerUnknown, err.Error())
+	}
+	home, err := stub.GetState(tenantHomeKey)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if home == nil {
+		stub.PutState(tenantHomeKey, []byte(tenant))
+	}
+	if _, auditors := stub.GetFunctionAndParameters(); len(auditors) != 0 {
+		stub.PutState(tenantAuditorsKey, []byte(strings.Join(auditors, ",")))
+	}
+
+	//GetState does not see the home tenant put above, so the stub is made here and not with newTenantStub
+	//an upgrade by another org than the home tenant writes the demo fleet to its own tenant
+	initStub := &tenantStub{ChaincodeStubInterface: stub, tenant: tenant}
+	if home != nil && string(home) != tenant {
+		initStub.prefix = tenantKeyPrefix + tenant + "/"
+		registerTenant(stub, tenant)
+	}
+	stub = initStub
+
 	cars := []Car{
-		Car{Id: 1, Km: 1000, BorrowId: 0},
-		Car{Id: 2, Km: 1500, BorrowId: 0},
-		Car{Id: 3, Km: 1800, BorrowId: 0},
+		Car{Id: 1, Km: 1000, BorrowId: 0, OwnerOrg: tenant},
+		Car{Id: 2, Km: 1500, BorrowId: 0, OwnerOrg: tenant},
+		Car{Id: 3, Km: 1800, BorrowId: 0, OwnerOrg: tenant},
 	}
 
+	//the test users get a verified licence, so they can borrow the cars right away
+	verified := ledgerNow(stub).Format(timeFormat)
 	users := []User{
-		User{Id: 1, Name: "Alice", BorrowId: 0},
-		User{Id: 2, Name: "Bob", BorrowId: 0},
-		User{Id: 3, Name: "Daniel", BorrowId: 0},
+		User{Id: 1, BorrowId: 0, LicenceClasses: []string{"B"}, LicenceExpiry: "2033-01-01", LicenceVerified: verified, LicenceVerifiedBy: "init"},
+		User{Id: 2, BorrowId: 0, LicenceClasses: []string{"B"}, LicenceExpiry: "2033-01-01", LicenceVerified: verified, LicenceVerifiedBy: "init"},
+		User{Id: 3, BorrowId: 0, LicenceClasses: []string{"B"}, LicenceExpiry: "2033-01-01", LicenceVerified: verified, LicenceVerifiedBy: "init"},
+	}
+	names := []string{"Alice", "Bob", "Daniel"}
 
+	//the salts of the test users are made from a secret of the transient map - real users bring their own one
+	secret, response, ok := readTransientSalt(stub)
+	if !ok {
+		return response
 	}
 
 	i := 0
 	for i < len(cars) {
+		if err := putUserPII(stub, &users[i], UserPII{Name: names[i], Salt: saltedHash(secret, names[i])}); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
 		carAsBytes, _ := json.Marshal(cars[i])
 		userAsBytes, _ := json.Marshal(users[i])
 		stub.PutState("car"+strconv.Itoa(i+1), carAsBytes)
 		stub.PutState("user"+strconv.Itoa(i+1), userAsBytes)
+		if err := setOwnerPolicy(stub, "car"+strconv.Itoa(i+1), tenant); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
 		i = i + 1
 	}
 	//init borrow counter
@@ -136,70 +290,47 @@ func (cc *CRUD) Init(stub shim.ChaincodeStubInterface) peer.Response {
 // Invoke is called to update or query the ledger in a proposal transaction.
 // Updated state variables are not committed to the ledger until the
 // transaction is committed.
-//
 func (cc *CRUD) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
 
 	function, args := stub.GetFunctionAndParameters()
 
-	switch strings.ToLower(function) {
-	//CAR OPERATIONS
-	case "createcar":
-		return cc.createCar(stub, args)
-	case "getcarbyid":
-		return cc.getCar(stub, args)
-	case "updatecar":
-		return cc.updateCar(stub, args)
-	case "deletecar":
-		return cc.deleteCar(stub, args)
-	case "getallcars":
-		return cc.getAllCars(stub, args)
-
-	//USER OPERATIONS
-	case "createuser":
-		return cc.createUser(stub, args)
-	case "getuserbyid":
-		return cc.getUser(stub, args)
-	case "updateuser":
-		return cc.updateUser(stub, args)
-	case "deleteuser":
-		return cc.deleteUser(stub, args)
-	case "getalluser":
-		return cc.getAllUser(stub, args)
-
-	//USER OPERATION
-	case "userborrowacar":
-		return cc.userBorrowACar(stub, args)
-	case "userreturnacar":
-		return cc.userReturnACar(stub, args)
-	case "getalltravellogsforuser":
-		return cc.getAllTravelLogsForUser(stub, args)
-
-	//ADMINISTRATION
-
-	case "getborrowlogbyid":
-		return cc.getBorrowLogById(stub, args)
-	case "gettravellogbyid":
-		return cc.getTravelLogById(stub, args)
-	case "getallborrowlogs":
-		return cc.getAllBorrowLogs(stub, args)
-	case "getalltravellogs":
-		return cc.getAllTravelLogs(stub, args)
-
-	//TESTING
-	case "getallkeys":
-		return cc.getAllKeys(stub, args)
-	case "getallvalues":
-		return cc.getAllValues(stub, args)
-	case "getalldata":
-		return cc.getAllData(stub, args)
-	case "nfcborrow":
-		return cc.nfcBorrow(stub, args)
-	case "nfcreturn":
-		return cc.nfcReturn(stub, args)
-	default:
+	//the registry knows the arguments and the role of every function, so a handler only gets args it can use
+	spec, found := functionsByName[strings.ToLower(function)]
+	if !found {
 		logger.Warningf("Invoke('%s') invalid!", function)
-		return Error(http.StatusNotImplemented, "Invalid method name!!!")
+		return Error(http.StatusNotImplemented, codeUnknownFunction, "Invalid method name!!!")
+	}
+	//the handlers take the time from the transaction, see ledgerNow
+	if timestamp, err := stub.GetTxTimestamp(); err != nil || timestamp == nil {
+		return Error(http.StatusInternalServerError, codeInternal, "the transaction has no timestamp")
+	}
+	if !checkRole(stub, spec) {
+		if spec.Role == roleAuditor {
+			return Error(http.StatusForbidden, codeAuditorRequired, "only an auditor can call "+spec.Name)
+		}
+		return Error(http.StatusForbidden, codeAdminRequired, "only an admin can call "+spec.Name)
+	}
+	args, response, ok := checkArgs(spec, args)
+	if !ok {
+		return response
+	}
+
+	//every tenant has his own fleet - the handler just gets the stub of the tenant of the caller
+	tenant, err := callerTenant(stub)
+	if err != nil {
+		return Error(http.StatusForbidden, codeCallerUnknown, err.Error())
+	}
+	if !spec.Query {
+		if err := registerTenant(stub, tenant); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+	}
+	tenantStub, err := newTenantStub(stub, tenant)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
+
+	return spec.handler(cc, tenantStub, args)
 }
 
 //========================================CAR=================================================
@@ -207,9 +338,9 @@ func (cc *CRUD) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
 func (cc *CRUD) getCar(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
 	if msg, err := stub.GetState("car" + args[0]); err == nil && msg != nil {
-		return Success(http.StatusOK, "OK", msg)
+		return Success(http.StatusOK, "OK", upgradedDocument("car", msg))
 	} else {
-		return Error(http.StatusNotFound, "Car Not Found")
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found")
 	}
 }
 
@@ -218,36 +349,51 @@ func (cc *CRUD) createCar(stub shim.ChaincodeStubInterface, args []string) peer.
 	//(path) -> args[0]: "id"
 	//(body) -> args[1]: {"id":7,"km":7777,"borrowId":0}
 	if obj, err := stub.GetState("car" + args[0]); err != nil || obj != nil {
-		return Error(http.StatusConflict, "a car with this id already exists")
+		return Error(http.StatusConflict, codeCarAlreadyExists, "a car with this id already exists")
 	}
 
-	//create a car with the overgiven parameters
-	noSlashCar := strings.Replace(args[1], "\\", "", -1)
+	//create a car with the overgiven parameters - an escaped body is fine, see unescapeBody
 	var car Car
-	err := json.Unmarshal([]byte(noSlashCar), &car)
-	if err != nil {
-		return Error(http.StatusBadRequest, "Unmarshalling the overgiven Data failed - args[1]= "+args[1]+" :: noSlashCar= "+noSlashCar)
+	if response, ok := decodeBody("car", args[1], documentFields(&car)); !ok {
+		return response
 	}
 
 	//check if the car has all three values
-	if car.Id == 0 || car.Km == 0 || car.BorrowId != 0 {
-		return Error(http.StatusBadRequest, "One parameter is wrong! car .id= "+strconv.Itoa(car.Id)+" - .km= "+strconv.Itoa(car.Km)+" - .borrowId= "+strconv.Itoa(car.BorrowId))
+	if details := checkCarFields(car); len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
 	}
 
 	//check if car.id is the same id as in path
 	erg, err := strconv.Atoi(args[0])
 	if err != nil {
-		return Error(http.StatusInternalServerError, "path id cant be changed to a string - should never happen!")
+		return Error(http.StatusInternalServerError, codeInternal, "path id cant be changed to a string - should never happen!")
 	}
 	if car.Id != erg {
-		return Error(http.StatusBadRequest, "id of path and id of car are different!")
+		return Error(http.StatusBadRequest, codeIdMismatch, "id of path and id of car are different!")
+	}
+
+	//a new car is in no pool until an admin assigns it and belongs to the org of the caller
+	car.PoolId = 0
+	car.OwnerOrg, err = callerTenant(stub)
+	if err != nil {
+		return Error(http.StatusForbidden, codeCallerUnknown, err.Error())
 	}
 
-	if err := stub.PutState("car "+args[0], []byte(noSlashCar)); err == nil {
-		stub.SetEvent("Car created"+args[1]+" __ "+noSlashCar, []byte("Success"))
+	//check the location of the car - a site fills in lat/long
+	car.Location, err = resolveLocation(stub, car.Location)
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidLocation, err.Error(), fieldError("location", err.Error()))
+	}
+
+	carAsBytes, _ := json.Marshal(car)
+	if err := stub.PutState("car"+args[0], carAsBytes); err == nil {
+		if err := setOwnerPolicy(stub, "car"+args[0], car.OwnerOrg); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		stub.SetEvent("Car created", carAsBytes)
 		return Success(http.StatusCreated, "Ok", nil)
 	} else {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 
 }
@@ -255,32 +401,75 @@ func (cc *CRUD) createCar(stub shim.ChaincodeStubInterface, args []string) peer.
 //====================================PUT-CAR=================================================
 func (cc *CRUD) updateCar(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	if obj, err := stub.GetState("car" + args[0]); obj == nil || err != nil {
-		return Error(http.StatusNotFound, "this car does not exist")
+	obj, err := stub.GetState("car" + args[0])
+	if obj == nil || err != nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "this car does not exist")
 	}
 
+	var ledgerCar Car
+	json.Unmarshal(obj, &ledgerCar)
+
 	var car Car
-	json.Unmarshal([]byte(args[1]), &car)
+	if response, ok := decodeBody("car", args[1], documentFields(&car)); !ok {
+		return response
+	}
 
 	//check if the car has all three values
-	if car.Id == 0 || car.Km == 0 || car.BorrowId != 0 {
-		return Error(http.StatusBadRequest, "one parameter is wrong!")
+	if details := checkCarFields(car); len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
 	}
 
 	//check if car.id is the same id as in path
 	erg, err := strconv.Atoi(args[0])
 	if err != nil {
-		return Error(http.StatusBadRequest, "path id cant be changed to a string - should never happen!")
+		return Error(http.StatusBadRequest, codeInvalidParameter, "path id cant be changed to a string - should never happen!")
 	}
 	if car.Id != erg {
-		return Error(http.StatusBadRequest, "id of path and id of car are different!")
+		return Error(http.StatusBadRequest, codeIdMismatch, "id of path and id of car are different!")
+	}
+
+	//the km of a car only change by a trip - everything else is an odometer correction made by an admin
+	//(optional) args[2]: reason of the correction - needed in logbook mode
+	if car.Km != ledgerCar.Km {
+		if !isAdmin(stub) {
+			return Error(http.StatusForbidden, codeAdminRequired, "only an admin can correct the km of a car")
+		}
+		if ledgerCar.BorrowId != 0 {
+			return Error(http.StatusConflict, codeCarAlreadyBorrowed, "the km of a borrowed car cant be corrected")
+		}
+
+		reason := args[2]
+
+		logbook, err := getLogbookOfCar(stub, car.Id)
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		if logbook.Enabled && reason == "" {
+			return Error(http.StatusBadRequest, codeCorrectionReason, "a km correction of a car in logbook mode needs a reason", fieldError("reason", "is needed in logbook mode"))
+		}
+		if err := recordOdometerCorrection(stub, &logbook, kindCorrection, ledgerCar.Km, car.Km, reason); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, "create odometer correction failed")
+		}
+	}
+
+	//the borrow, the pool and the owner are never changed by an update and the location only if a new one is overgiven
+	car.BorrowId = ledgerCar.BorrowId
+	car.PoolId = ledgerCar.PoolId
+	car.OwnerOrg = ledgerCar.OwnerOrg
+	if car.Location.isEmpty() {
+		car.Location = ledgerCar.Location
+	}
+	car.Location, err = resolveLocation(stub, car.Location)
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidLocation, err.Error(), fieldError("location", err.Error()))
 	}
 
-	if err := stub.PutState("car"+args[0], []byte(args[1])); err == nil {
+	carAsBytes, _ := json.Marshal(car)
+	if err := stub.PutState("car"+args[0], carAsBytes); err == nil {
 		stub.SetEvent("Car updated", []byte("Success"))
 		return Success(http.StatusCreated, "Updated", nil)
 	} else {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 
 }
@@ -288,17 +477,65 @@ func (cc *CRUD) updateCar(stub shim.ChaincodeStubInterface, args []string) peer.
 //====================================DELETE-CAR==================================================
 func (cc *CRUD) deleteCar(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	if msg, err := stub.GetState("car" + args[0]); err != nil || msg == nil {
-		return Error(http.StatusNotFound, "Car Not Found")
+	ledgerCar, err := stub.GetState("car" + args[0])
+	if err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found")
+	}
+	var car Car
+	json.Unmarshal(ledgerCar, &car)
+	if car.BorrowId != 0 {
+		return Error(http.StatusConflict, codeCarAlreadyBorrowed, "a borrowed car cant be deleted")
+	}
+
+	//the logbook, the odometer offset and the statistics are the history of the car, its travelLogs and
+	//corrections belong to them - a car created again with the same id would go on with them
+	for _, key := range []string{"logbook" + args[0], "odoOffset" + args[0], "statsCar" + args[0]} {
+		obj, err := stub.GetState(key)
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		if obj != nil {
+			return Error(http.StatusConflict, codeCarHasHistory, "the car has trips or odometer records - set its status to inactive instead")
+		}
+	}
+
+	//everything else of a car that never drove goes with it in the same transaction
+	if err := deleteCarRecords(stub, car.Id); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if err := stub.DelState("car" + args[0]); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, "Something bad happend")
 	}
+	stub.SetEvent("Car deleted", []byte("Success"))
+	return Success(http.StatusOK, "OK", []byte("Car deleted"))
+}
 
-	err := stub.DelState("car" + args[0])
+//deleteCarRecords deletes the reservations, maintenance blocks, keys, counters and boxes of a car
+//the readings of its boxes stay like with deleteDevice
+func deleteCarRecords(stub shim.ChaincodeStubInterface, carId int) error {
+	for _, prefix := range []string{"reservation", "maintenance", "physKey", "keyEvent"} {
+		startKey, endKey := scopedRange(prefix, carId)
+		if err := deleteRange(stub, startKey, endKey); err != nil {
+			return err
+		}
+	}
+	for _, counter := range []string{"counterR", "counterM"} {
+		if err := stub.DelState(counter + strconv.Itoa(carId)); err != nil {
+			return err
+		}
+	}
+
+	devices, err := devicesOfCar(stub, carId)
 	if err != nil {
-		return Error(http.StatusInternalServerError, "Something bad happend")
-	} else {
-		stub.SetEvent("Car deleted", []byte("Success"))
-		return Success(http.StatusOK, "OK", []byte("Car deleted"))
+		return err
+	}
+	for _, device := range devices {
+		if err := stub.DelState("dev" + strconv.Itoa(device.Id)); err != nil {
+			return err
+		}
 	}
+	startKey, endKey := scopedRange("telematics", carId)
+	return deleteRange(stub, startKey, endKey)
 }
 
 //========================================================================================
@@ -307,9 +544,13 @@ func (cc *CRUD) deleteCar(stub shim.ChaincodeStubInterface, args []string) peer.
 func (cc *CRUD) getUser(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
 	if msg, err := stub.GetState("user" + args[0]); err == nil && msg != nil {
-		return Success(http.StatusOK, "OK", msg)
+		//decoding drops the name old users still have in the public state
+		var user User
+		json.Unmarshal(msg, &user)
+		userAsBytes, _ := json.Marshal(user)
+		return Success(http.StatusOK, "OK", userAsBytes)
 	} else {
-		return Error(http.StatusNotFound, "User Not Found")
+		return Error(http.StatusNotFound, codeUserNotFound, "User Not Found")
 	}
 }
 
@@ -317,36 +558,65 @@ func (cc *CRUD) getUser(stub shim.ChaincodeStubInterface, args []string) peer.Re
 func (cc *CRUD) createUser(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
 	if obj, err := stub.GetState("user" + args[0]); err != nil || obj != nil {
-		return Error(http.StatusConflict, "this user already exists")
+		return Error(http.StatusConflict, codeUserAlreadyExists, "this user already exists")
 	}
 
 	//validate args[1] -> JSON object. This must have a specific look
 	//args[]: "idNumber"
 	//args[1]: {"id":"string","km":"string","owner":"string"} standard
 
-	//create a car with the overgiven parameters
+	//the name is no field of a user anymore, so this has to be checked before the body is decoded
+	if hasNameField([]byte(unescapeBody(args[1]))) {
+		return Error(http.StatusBadRequest, codeInvalidPersonalData, "the name has to be overgiven in the transient map and not in the body")
+	}
+
+	//create a user with the overgiven parameters
 	var user User
-	json.Unmarshal([]byte(args[1]), &user)
+	if response, ok := decodeBody("user", args[1], documentFields(&user)); !ok {
+		return response
+	}
 
-	//check if the car has all three values
-	if user.Id == 0 || user.Name == "" || user.BorrowId != 0 {
-		return Error(http.StatusBadRequest, "one parameter is wrong!")
+	//check if the user has all values
+	if details := checkUserFields(user); len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
+	}
+
+	//the personal data comes in the transient map and a new user needs it with a salt
+	overgivenPII, found, err := readTransientUserPII(stub)
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidPersonalData, err.Error())
+	}
+	if !found || overgivenPII.Salt == "" {
+		return Error(http.StatusBadRequest, codeInvalidPersonalData, "a new user needs his name and a salt in the transient map")
 	}
 
 	//check if car.id is the same id as in path
 	erg, err := strconv.Atoi(args[0])
 	if err != nil {
-		return Error(http.StatusBadRequest, "path id cant be changed to a string - should never happen!")
+		return Error(http.StatusBadRequest, codeInvalidParameter, "path id cant be changed to a string - should never happen!")
 	}
 	if user.Id != erg {
-		return Error(http.StatusBadRequest, "id of path and id of car are different!")
+		return Error(http.StatusBadRequest, codeIdMismatch, "id of path and id of car are different!")
+	}
+
+	//a new user has no licence and no pools until an admin gives them to him
+	user.Pools = nil
+	user.LicenceClasses = nil
+	user.LicenceExpiry = ""
+	user.LicenceVerified = ""
+	user.LicenceVerifiedBy = ""
+	user.Pseudonym = ""
+
+	if err := putUserPII(stub, &user, UserPII{Name: overgivenPII.Name, Salt: overgivenPII.Salt}); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 
-	if err := stub.PutState("user"+args[0], []byte(args[1])); err == nil {
+	userAsBytes, _ := json.Marshal(user)
+	if err := stub.PutState("user"+args[0], userAsBytes); err == nil {
 		stub.SetEvent("User created", []byte("Success"))
 		return Success(http.StatusCreated, "Created", nil)
 	} else {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 
 }
@@ -354,32 +624,80 @@ func (cc *CRUD) createUser(stub shim.ChaincodeStubInterface, args []string) peer
 //=============================PUT-USER====================================================
 func (cc *CRUD) updateUser(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	if obj, err := stub.GetState("user" + args[0]); obj == nil || err != nil {
-		return Error(http.StatusLocked, "this user does not exist")
+	obj, err := stub.GetState("user" + args[0])
+	if obj == nil || err != nil {
+		return Error(http.StatusNotFound, codeUserNotFound, "this user does not exist")
+	}
+
+	var ledgerUser User
+	json.Unmarshal(obj, &ledgerUser)
+	if ledgerUser.Erased {
+		return Error(http.StatusGone, codeUserErased, "the user was erased")
 	}
 
+	if hasNameField([]byte(unescapeBody(args[1]))) {
+		return Error(http.StatusBadRequest, codeInvalidPersonalData, "the name has to be overgiven in the transient map and not in the body")
+	}
 	var user User
-	json.Unmarshal([]byte(args[1]), &user)
+	if response, ok := decodeBody("user", args[1], documentFields(&user)); !ok {
+		return response
+	}
 
-	//check if the car has all three values
-	if user.Id == 0 || user.Name == "" || user.BorrowId != 0 {
-		return Error(http.StatusBadRequest, "one parameter is wrong!")
+	//check if the user has all values
+	if details := checkUserFields(user); len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
 	}
 
 	//check if car.id is the same id as in path
 	erg, err := strconv.Atoi(args[0])
 	if err != nil {
-		return Error(http.StatusBadRequest, "path id cant be changed to a string - should never happen!")
+		return Error(http.StatusBadRequest, codeInvalidParameter, "path id cant be changed to a string - should never happen!")
 	}
 	if user.Id != erg {
-		return Error(http.StatusBadRequest, "id of path and id of car are different!")
+		return Error(http.StatusBadRequest, codeIdMismatch, "id of path and id of car are different!")
+	}
+
+	//the borrow, the pools and the licence are never changed by an update
+	user.BorrowId = ledgerUser.BorrowId
+	user.Pools = ledgerUser.Pools
+	user.LicenceClasses = ledgerUser.LicenceClasses
+	user.LicenceExpiry = ledgerUser.LicenceExpiry
+	user.LicenceVerified = ledgerUser.LicenceVerified
+	user.LicenceVerifiedBy = ledgerUser.LicenceVerifiedBy
+	user.Pseudonym = ledgerUser.Pseudonym
+	user.NameHash = ledgerUser.NameHash
+
+	//a new name in the transient map is hashed with the salt the user already has and the pseudonym stays
+	//a new salt would change the pseudonym, the public id other records and systems know the user by
+	overgivenPII, found, err := readTransientUserPII(stub)
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidPersonalData, err.Error())
+	}
+	if found {
+		ledgerPII, err := getUserPIIOfUser(stub, user.Id)
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		if ledgerPII != nil {
+			if overgivenPII.Salt != "" && overgivenPII.Salt != ledgerPII.Salt {
+				return Error(http.StatusBadRequest, codeInvalidPersonalData, "the salt of a user cant be changed, it would change his pseudonym", fieldError("salt", "has to be left out"))
+			}
+			overgivenPII.Salt = ledgerPII.Salt
+		}
+		if overgivenPII.Salt == "" {
+			return Error(http.StatusBadRequest, codeInvalidPersonalData, "the user has no salt yet, so one has to be overgiven in the transient map")
+		}
+		if err := putUserPII(stub, &user, UserPII{Name: overgivenPII.Name, Salt: overgivenPII.Salt}); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
 	}
 
-	if err := stub.PutState("user"+args[0], []byte(args[1])); err == nil {
+	userAsBytes, _ := json.Marshal(user)
+	if err := stub.PutState("user"+args[0], userAsBytes); err == nil {
 		stub.SetEvent("User updated", []byte("Success"))
 		return Success(http.StatusCreated, "Created", nil)
 	} else {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 
 }
@@ -388,12 +706,17 @@ func (cc *CRUD) updateUser(stub shim.ChaincodeStubInterface, args []string) peer
 func (cc *CRUD) deleteUser(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
 	if msg, err := stub.GetState("user" + args[0]); err != nil || msg == nil {
-		return Error(http.StatusNotFound, "User Not Found")
+		return Error(http.StatusNotFound, codeUserNotFound, "User Not Found")
+	}
+
+	//the personal data goes with the user - eraseUser is the one that keeps a tombstone
+	if err := stub.DelPrivateData(collectionUserPII, "user"+args[0]); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 
 	err := stub.DelState("user" + args[0])
 	if err != nil {
-		return Error(http.StatusInternalServerError, "Something bad happend")
+		return Error(http.StatusInternalServerError, codeInternal, "Something bad happend")
 	} else {
 		stub.SetEvent("User deleted", []byte("Success"))
 		return Success(http.StatusOK, "OK", []byte("User deleted"))
@@ -408,16 +731,94 @@ func (cc *CRUD) userBorrowACar(stub shim.ChaincodeStubInterface, args []string)
 
 	//create a borrow obj. and init it with the overgiven parameters
 	var overgivenParam CheckBorrowCarParameter
-	json.Unmarshal([]byte(args[1]), &overgivenParam)
+	if response, ok := decodeBody("borrow", args[1], &overgivenParam); !ok {
+		return response
+	}
 
 	var overgivenUserId, err = strconv.Atoi(args[0])
 	if err != nil {
-		return Error(http.StatusBadRequest, "Cant Atoi args[0] ")
+		return Error(http.StatusBadRequest, codeInvalidParameter, "Cant Atoi args[0] ")
 	}
 
+	return borrowCar(stub, overgivenUserId, overgivenParam, "")
+}
+
+//borrowCar does the checks and writes of a borrow - userBorrowACar, nfcBorrow and qrBorrow only differ in how they find the user
+//via is how the car was borrowed for the event, e.g. " by qr"
+func borrowCar(stub shim.ChaincodeStubInterface, overgivenUserId int, overgivenParam CheckBorrowCarParameter, via string) peer.Response {
+
 	//check if all parameters have a value
 	if overgivenParam.CarId == 0 || overgivenUserId == 0 {
-		return Error(http.StatusBadRequest, "one parameter is wrong!")
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", fieldError("carId", "has to be greater than 0"))
+	}
+
+	//check the user
+	ledgerUser, _ := stub.GetState("user" + strconv.Itoa(overgivenUserId))
+	var user User
+	json.Unmarshal([]byte(ledgerUser), &user)
+
+	if user.Id == 0 {
+		return Error(http.StatusNotFound, codeUserNotFound, "User Not Found - wrong overgiven userId!")
+	}
+	if user.Erased {
+		return Error(http.StatusGone, codeUserErased, "the user was erased")
+	}
+	if user.BorrowId != 0 {
+		return Error(http.StatusConflict, codeUserAlreadyBorrowing, "User is already borrowing a car!")
+	}
+
+	//check the car
+	ledgerCar, _ := stub.GetState("car" + strconv.Itoa(overgivenParam.CarId))
+	var car Car
+	json.Unmarshal([]byte(ledgerCar), &car)
+
+	if car.Id == 0 {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found - wrong overgiven carId!")
+	}
+	if car.BorrowId != 0 {
+		return Error(http.StatusConflict, codeCarAlreadyBorrowed, "Car is already borrowed by a Car!")
+	}
+	//an inactive car, a car in the workshop and a car reserved for someone else cant be borrowed now
+	reason, err := checkCarFreeNow(stub, car, user.Id)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if reason != "" {
+		return Error(http.StatusConflict, codeCarNotAvailable, reason)
+	}
+
+	//the insurance only pays if the user holds a valid licence for the car
+	if msg := checkLicence(user, car, ledgerNow(stub)); msg != "" {
+		return Error(http.StatusForbidden, codeLicenceInvalid, msg)
+	}
+	if !isEntitled(user, car) {
+		return Error(http.StatusForbidden, codeNotEntitled, "the user is not entitled to the pool of this car")
+	}
+
+	//the driver confirms the condition of the car - a checklist without a mandatory item is rejected
+	template, err := readChecklistTemplate(stub, car.Category)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	pickupChecklist, code, details := checkChecklist(template, "checklist", overgivenParam.Checklist)
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, code, details[0].Field+" "+details[0].Message, details...)
+	}
+	//a car that fails a mandatory check does not leave, the fleet staff has to fix it first
+	if failed := failedChecks(template, pickupChecklist); len(failed) != 0 {
+		for _, item := range failed {
+			details = append(details, fieldError("checklist", "says "+item+" is not ok"))
+		}
+		return Error(http.StatusConflict, codeChecklistFailed, "the car failed the mandatory checks "+strings.Join(failed, ", "), details...)
+	}
+
+	//the car is picked up where it is, as long as the user doesnt say something else
+	pickupLocation, err := resolveLocation(stub, overgivenParam.Location)
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidLocation, err.Error(), fieldError("location", err.Error()))
+	}
+	if pickupLocation.isEmpty() {
+		pickupLocation = car.Location
 	}
 
 	//create counter and init it with the data in ledger
@@ -426,104 +827,91 @@ func (cc *CRUD) userBorrowACar(stub shim.ChaincodeStubInterface, args []string)
 	counter += 1
 
 	//create Starttime
-	time := time.Now()
-	timeString := time.Format("2006-01-02 15:04:05")
+	time := ledgerNow(stub)
+	timeString := time.Format(timeFormat)
 
 	//create CarBorrow struct and put it in the ledger
-	carBorrow := CarBorrow{Id: counter, CarId: overgivenParam.CarId, UserId: overgivenUserId, StartTime: timeString}
+	carBorrow := CarBorrow{Id: counter, CarId: overgivenParam.CarId, UserId: overgivenUserId, StartTime: timeString, PickupLocation: pickupLocation, PickupChecklist: pickupChecklist, OwnerOrg: car.OwnerOrg}
 	carBorrowAsBytes, _ := json.Marshal(carBorrow)
 	stub.PutState("borrow"+strconv.Itoa(counter), carBorrowAsBytes)
+	if err := setOwnerPolicy(stub, "borrow"+strconv.Itoa(counter), car.OwnerOrg); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
 
 	//update cborrow
 	stub.PutState("counterB", []byte(strconv.Itoa(counter)))
 
 	//update user
-	ledgerUser, _ := stub.GetState("user" + strconv.Itoa(overgivenUserId))
-	var user User
-	json.Unmarshal([]byte(ledgerUser), &user)
-
-	if user.Id == 0 {
-		return Error(http.StatusNotFound, "User Not Found - wrong overgiven userId!")
-	}
-	if user.BorrowId != 0 {
-		return Error(http.StatusConflict, "User is already borrowing a car!")
-	}
-
 	user.BorrowId = counter
 	userAsBytes, _ := json.Marshal(user)
 	stub.PutState("user"+strconv.Itoa(user.Id), userAsBytes)
 
 	//update car
-	ledgerCar, _ := stub.GetState("car" + strconv.Itoa(overgivenParam.CarId))
-	var car Car
-	json.Unmarshal([]byte(ledgerCar), &car)
-
-	if car.Id == 0 {
-		return Error(http.StatusNotFound, "Car Not Found - wrong overgiven carId!")
-	}
-	if car.BorrowId != 0 {
-		return Error(http.StatusConflict, "Car is already borrowed by a Car!")
-	}
-
 	car.BorrowId = counter
+	car.Location = pickupLocation
 	carAsBytes, _ := json.Marshal(car)
 	stub.PutState("car"+strconv.Itoa(car.Id), carAsBytes)
 
 	//Create Event
-	eventString := "User with id: " + strconv.Itoa(user.Id) + " borrowed successfully car with id: " + strconv.Itoa(car.Id)
-	stub.SetEvent("Borrow a car", []byte(eventString))
-	return Success(http.StatusOK, "OK", []byte("Borrow a car accepted"))
+	eventString := "User with id: " + strconv.Itoa(user.Id) + " borrowed successfully car" + via + " with id: " + strconv.Itoa(car.Id)
+	stub.SetEvent("Borrow a car"+via, []byte(eventString))
+	return Success(http.StatusOK, "OK", []byte("Borrow a car"+via+" accepted"))
 
 }
 
 //========================GET A TRAVELLOG BY ID========================================
 func (cc *CRUD) getAllTravelLogsForUser(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	if len(args) != 1 {
-		return Error(http.StatusBadRequest, "Parameter Mismatch")
-	}
-
 	intargs, err := strconv.Atoi(args[0])
 	if err != nil {
-		return Error(http.StatusBadRequest, "overgiven header cant be converted to an int")
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven header cant be converted to an int")
 	}
 
 	//return all keys between t and u = all TravelLogs
 	resultsIterator, err := stub.GetStateByRange("t", "u")
 	if err != nil {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 	defer resultsIterator.Close()
 
-	var buffer bytes.Buffer
-	buffer.WriteString("[\n")
-
-	var travelLog TravelLog
+	travelLogs := []TravelLog{}
 	for resultsIterator.HasNext() {
-		it, _ := resultsIterator.Next()
-
-		ledgerTravelLog, _ := stub.GetState(it.Key)
-		json.Unmarshal([]byte(ledgerTravelLog), &travelLog)
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
 
+		var travelLog TravelLog
+		if err := json.Unmarshal(it.Value, &travelLog); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, "travelLog "+it.Key+" is broken")
+		}
 		if travelLog.UserId == intargs {
-
-			buffer.WriteString(string(it.Value))
-			buffer.WriteString(",\n")
+			travelLogs = append(travelLogs, travelLog)
 		}
 	}
 
-	buffer.WriteString("]")
-
-	return Success(http.StatusOK, "OK", buffer.Bytes())
+	travelLogsAsBytes, _ := json.Marshal(travelLogs)
+	return Success(http.StatusOK, "OK", travelLogsAsBytes)
 }
 
 //===========================USER CAN RETURN HIS CAR==============================
 func (cc *CRUD) userReturnACar(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
+	var overgivenParam CheckReturnCarParameter
+	if response, ok := decodeBody("return", args[1], &overgivenParam); !ok {
+		return response
+	}
+	return returnCar(stub, args[0], overgivenParam, 0, "")
+}
+
+//returnCar does the checks and writes of a return - userReturnACar, qrReturn and nfcReturn only differ in how they find the user
+//carId is the car the user has to return, 0 for the one he borrowed - via is how the car was returned for the event
+func returnCar(stub shim.ChaincodeStubInterface, userId string, overgivenParam CheckReturnCarParameter, carId int, via string) peer.Response {
+
 	//get User out of ledger and init it here in Code
-	ledgerUser, err := stub.GetState("user" + args[0])
+	ledgerUser, err := stub.GetState("user" + userId)
 	if err != nil || ledgerUser == nil {
-		return Error(http.StatusBadRequest, "This user doenst exist!")
+		return Error(http.StatusNotFound, codeUserNotFound, "This user doenst exist!")
 	}
 
 	var user User
@@ -531,16 +919,24 @@ func (cc *CRUD) userReturnACar(stub shim.ChaincodeStubInterface, args []string)
 
 	//check if a car is borrowed
 	if user.BorrowId == 0 {
-		return Error(http.StatusBadRequest, "This user dont have a borrowed car!")
+		return Error(http.StatusBadRequest, codeUserNotBorrowing, "This user dont have a borrowed car!")
 	}
 
-	//init values of body
-	var overgivenParam CheckReturnCarParameter
-	json.Unmarshal([]byte(args[1]), &overgivenParam)
-
 	//check if all parameters have a value
 	if overgivenParam.NewKm == 0 || overgivenParam.Usage == "" {
-		return Error(http.StatusBadRequest, "Overgiven paramters are wrong!")
+		details := []FieldError{}
+		if overgivenParam.NewKm == 0 {
+			details = append(details, fieldError("newKm", "has to be greater than 0"))
+		}
+		if overgivenParam.Usage == "" {
+			details = append(details, fieldError("usage", "cant be empty"))
+		}
+		return Error(http.StatusBadRequest, codeInvalidParameter, "Overgiven paramters are wrong!", details...)
+	}
+
+	dropoffLocation, err := resolveLocation(stub, overgivenParam.Location)
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidLocation, err.Error(), fieldError("location", err.Error()))
 	}
 
 	//get the borrowInformation to get the borrowed car
@@ -549,7 +945,10 @@ func (cc *CRUD) userReturnACar(stub shim.ChaincodeStubInterface, args []string)
 	json.Unmarshal([]byte(ledgerBorrow), &carBorrow)
 
 	if carBorrow.CarId == 0 {
-		return Error(http.StatusBadRequest, "Couldnt find car!")
+		return Error(http.StatusNotFound, codeCarNotFound, "Couldnt find car!")
+	}
+	if carId != 0 && carBorrow.CarId != carId {
+		return Error(http.StatusConflict, codeBorrowMismatch, "the user borrowed another car")
 	}
 
 	//get the car
@@ -558,55 +957,146 @@ func (cc *CRUD) userReturnACar(stub shim.ChaincodeStubInterface, args []string)
 	json.Unmarshal([]byte(ledgerCar), &car)
 
 	if car.BorrowId != user.BorrowId {
-		return Error(http.StatusBadRequest, "This Should not happen - check for user.Borrowid != car.Borrowid")
+		return Error(http.StatusBadRequest, codeBorrowMismatch, "This Should not happen - check for user.Borrowid != car.Borrowid")
 	}
 
 	//check the overgiven Km for corectness
 	if car.Km > overgivenParam.NewKm {
-		return Error(http.StatusBadRequest, "the overgiven newKm are lower than the km of the car when borrowed")
+		return Error(http.StatusBadRequest, codeInvalidKm, "the overgiven newKm are lower than the km of the car when borrowed", fieldError("newKm", "has to be at least "+strconv.Itoa(car.Km)))
+	}
+
+	time := ledgerNow(stub)
+	timeString := time.Format(timeFormat)
+
+	//check if the overgiven Km can be true at all
+	rules, err := readOdometerRules(stub)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if msg := checkOdometerPlausibility(rules, car.Km, overgivenParam.NewKm, carBorrow.StartTime, timeString); msg != "" {
+		return Error(http.StatusBadRequest, codeInvalidKm, "the overgiven newKm are not plausible: "+msg, fieldError("newKm", msg))
+	}
+
+	//the trip has to start where the trip before (or the last odometer correction) ended
+	logbook, err := getLogbookOfCar(stub, car.Id)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if logbook.LastLogId != 0 && car.Km != logbook.LastEndKm {
+		return Error(http.StatusConflict, codeOdometerGap, "the km of the car ("+strconv.Itoa(car.Km)+") dont continue the last trip ("+strconv.Itoa(logbook.LastEndKm)+") - an admin has to correct them")
+	}
+
+	//the telematics box of the car knows the km as well - too far off is flagged or rejected, see the odometer rules
+	telemetryKm, kmMismatch, msg, err := checkTelemetryKm(stub, rules, car.Id, carBorrow.StartTime, overgivenParam.NewKm)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	if kmMismatch && rules.TelemetryMismatch == telemetryMismatchReject {
+		return Error(http.StatusConflict, codeKmMismatch, msg, fieldError("newKm", "has to be within "+strconv.Itoa(rules.TelemetryToleranceKm)+" km of "+strconv.Itoa(telemetryKm)))
+	}
+
+	//a replaced odometer shows less km than the car has driven
+	offset, err := getOdometerOffsetOfCar(stub, car.Id)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	//the driver confirms the condition of the car again
+	template, err := readChecklistTemplate(stub, car.Category)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	dropoffChecklist, code, details := checkChecklist(template, "checklist", overgivenParam.Checklist)
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, code, details[0].Field+" "+details[0].Message, details...)
+	}
+	//a failed check at the return does not stop it either, the driver reported it and the fleet staff goes after it
+	checklistFailed := failedChecks(template, dropoffChecklist)
+
+	//the return is not stopped by a key that did not come back, the fleet staff goes after it
+	missingKeys, err := keysNotReturned(stub, carBorrow)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 
 	//create new travelLog and put it in the ledger
-	time := time.Now()
-	timeString := time.Format("2006-01-02 15:04:05")
 	drivenKm := overgivenParam.NewKm - car.Km
 
 	travelLog := TravelLog{
-		Id:        carBorrow.Id,
-		UserId:    user.Id,
-		CarId:     car.Id,
-		Usage:     overgivenParam.Usage,
-		StartKm:   car.Km,
-		EndKm:     overgivenParam.NewKm,
-		DrivenKm:  drivenKm,
-		StartTime: carBorrow.StartTime,
-		EndTime:   timeString,
+		Id:               carBorrow.Id,
+		UserId:           user.Id,
+		CarId:            car.Id,
+		Usage:            overgivenParam.Usage,
+		TripType:         overgivenParam.TripType,
+		BusinessPartner:  overgivenParam.BusinessPartner,
+		Route:            overgivenParam.Route,
+		StartKm:          car.Km,
+		EndKm:            overgivenParam.NewKm,
+		DrivenKm:         drivenKm,
+		StartTime:        carBorrow.StartTime,
+		EndTime:          timeString,
+		KmOffset:         offset.Offset,
+		PickupLocation:   carBorrow.PickupLocation,
+		DropoffLocation:  dropoffLocation,
+		TelemetryKm:      telemetryKm,
+		KmMismatch:       kmMismatch,
+		KeyNotReturned:   len(missingKeys) != 0,
+		ChecklistFailed:  checklistFailed,
+		PickupChecklist:  carBorrow.PickupChecklist,
+		DropoffChecklist: dropoffChecklist,
+	}
+
+	//a car in logbook mode needs a travelLog the tax authority accepts
+	if logbook.Enabled {
+		violations := logbookRuleViolations(travelLog, logbook.LastLogId != 0, logbook.LastEndKm)
+		if len(violations) != 0 {
+			violationsAsBytes, _ := json.Marshal(violations)
+			return Error(http.StatusBadRequest, codeLogbookViolation, "travelLog violates the logbook rules: "+string(violationsAsBytes))
+		}
+	}
+
+	//chain the travelLog to the one before - this is done for every car, not only in logbook mode
+	if err := chainTravelLog(stub, &logbook, &travelLog); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, "update logbook failed")
 	}
 
 	travelLogAsBytes, _ := json.Marshal(travelLog)
 	if err := stub.PutState("travelLog"+strconv.Itoa(travelLog.Id), travelLogAsBytes); err != nil {
-		return Error(http.StatusInternalServerError, "create travelLog failed")
+		return Error(http.StatusInternalServerError, codeInternal, "create travelLog failed")
+	}
+
+	//update the usage statistics of car, user and fleet
+	if err := updateStats(stub, travelLog); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, "update statistics failed")
 	}
 
 	//update user
 	user.BorrowId = 0
 	userAsBytes, _ := json.Marshal(user)
 	if err := stub.PutState("user"+strconv.Itoa(user.Id), userAsBytes); err != nil {
-		return Error(http.StatusInternalServerError, "Update user failed")
+		return Error(http.StatusInternalServerError, codeInternal, "Update user failed")
 	}
 
 	//update car
 	car.BorrowId = 0
 	car.Km = overgivenParam.NewKm
+	car.Location = dropoffLocation
 	carAsBytes, _ := json.Marshal(car)
 	if err := stub.PutState("car"+strconv.Itoa(car.Id), carAsBytes); err != nil {
-		return Error(http.StatusInternalServerError, "Update car failed")
+		return Error(http.StatusInternalServerError, codeInternal, "Update car failed")
 	}
 
 	//create Event when everything went right
-	str := "User: " + strconv.Itoa(user.Id) + " returened his Car: " + strconv.Itoa(car.Id) + " --> TravelLog: " + strconv.Itoa(travelLog.Id) + " created!"
-	stub.SetEvent("User returned Car", []byte(str))
-	return Success(http.StatusOK, "OK", []byte("Car returned"))
+	str := "User: " + strconv.Itoa(user.Id) + " returened his Car: " + strconv.Itoa(car.Id) + via + " --> TravelLog: " + strconv.Itoa(travelLog.Id) + " created!"
+	if travelLog.KeyNotReturned {
+		missingKeysAsBytes, _ := json.Marshal(missingKeys)
+		str += " - keys not returned: " + string(missingKeysAsBytes)
+	}
+	if len(travelLog.ChecklistFailed) != 0 {
+		str += " - failed checks: " + strings.Join(travelLog.ChecklistFailed, ", ")
+	}
+	stub.SetEvent("User returned Car"+via, []byte(str))
+	return Success(http.StatusOK, "OK", []byte("Car returned"+via))
 
 }
 
@@ -616,9 +1106,9 @@ func (cc *CRUD) userReturnACar(stub shim.ChaincodeStubInterface, args []string)
 func (cc *CRUD) getTravelLogById(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
 	if msg, err := stub.GetState("travelLog" + args[0]); err == nil && msg != nil {
-		return Success(http.StatusOK, "OK", msg)
+		return Success(http.StatusOK, "OK", upgradedDocument("travelLog", msg))
 	} else {
-		return Error(http.StatusNotFound, "TravelLog Not Found")
+		return Error(http.StatusNotFound, codeTravelLogNotFound, "TravelLog Not Found")
 	}
 
 }
@@ -627,367 +1117,332 @@ func (cc *CRUD) getTravelLogById(stub shim.ChaincodeStubInterface, args []string
 func (cc *CRUD) getBorrowLogById(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
 	if msg, err := stub.GetState("borrow" + args[0]); err == nil && msg != nil {
-		return Success(http.StatusOK, "OK", msg)
+		return Success(http.StatusOK, "OK", upgradedDocument("borrow", msg))
 	} else {
-		return Error(http.StatusNotFound, "Borrow Not Found")
+		return Error(http.StatusNotFound, codeBorrowNotFound, "Borrow Not Found")
 	}
 }
 
 //==============GET ALL CARS================================================================== READ
 func (cc *CRUD) getAllCars(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	//check for param length - No params needed here
-	if len(args) != 0 {
-		return Error(http.StatusBadRequest, "Parameter Mismatch")
+	//every param is optional - "" is no filter
+	//(query) -> args[0]: "pools" - "mine" = just the cars the caller is allowed to borrow, "" = all cars
+	//(query) -> args[1]: "available" - true = just the cars that are not borrowed, false = just the borrowed ones
+	//(query) -> args[2]: "minKm", args[3]: "maxKm"
+	//(query) -> args[4]: "category"
+	//(query) -> args[5]: "sort" e.g. "-km,id", args[6]: "fields" e.g. "id,borrowId" (see query.go)
+
+	available, details := parseOptionalBool("available", args[1])
+	minKm, minKmDetails := parseOptionalInt("minKm", args[2])
+	maxKm, maxKmDetails := parseOptionalInt("maxKm", args[3])
+	options, optionDetails := parseListOptions(Car{}, args[5], args[6])
+	details = append(append(append(details, minKmDetails...), maxKmDetails...), optionDetails...)
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
+	}
+
+	onlyMine := false
+	var caller User
+	if args[0] != "" {
+		if args[0] != "mine" {
+			return Error(http.StatusBadRequest, codeInvalidParameter, "pools can only be mine")
+		}
+		onlyMine = true
+
+		callerId, err := callerUserId(stub)
+		if err != nil {
+			return Error(http.StatusForbidden, codeCallerUnknown, err.Error())
+		}
+		ledgerUser, err := stub.GetState("user" + strconv.Itoa(callerId))
+		if err != nil || ledgerUser == nil {
+			return Error(http.StatusNotFound, codeUserNotFound, "User Not Found - the userId of the caller is wrong")
+		}
+		json.Unmarshal(ledgerUser, &caller)
 	}
 
 	//safe in resultsIterator all avaible keys for cars
 	resultsIterator, err := stub.GetStateByRange("car", "caw")
 	if err != nil {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 	defer resultsIterator.Close()
 
-	//create bytearray buffer to write in
-	var buffer bytes.Buffer
-	buffer.WriteString("[\n")
-
-	//as long there is a next key, write the value of the next key to the buffer
+	//as long there is a next key, add the car of the next key to the list
+	cars := []Car{}
 	for resultsIterator.HasNext() {
-		it, _ := resultsIterator.Next()
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
 
-		buffer.WriteString(string(it.Value))
-		buffer.WriteString(",\n")
+		var car Car
+		if err := json.Unmarshal(it.Value, &car); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, "car "+it.Key+" is broken")
+		}
+		if onlyMine && !isEntitled(caller, car) {
+			continue
+		}
+		if available != nil && *available != (car.BorrowId == 0) {
+			continue
+		}
+		if (minKm != nil && car.Km < *minKm) || (maxKm != nil && car.Km > *maxKm) {
+			continue
+		}
+		if args[4] != "" && car.Category != args[4] {
+			continue
+		}
+		cars = append(cars, car)
 	}
 
-	buffer.WriteString("]")
-
-	return Success(http.StatusOK, "OK", buffer.Bytes())
+	return listResponse(cars, options)
 }
 
 //============GET ALL USERS===SAME AS GETALLCARS======================================== READ
 func (cc *CRUD) getAllUser(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	if len(args) != 0 {
-		return Error(http.StatusBadRequest, "Parameter Mismatch")
+	//every param is optional - "" is no filter
+	//(query) -> args[0]: "borrowing" - true = just the users that borrow a car right now
+	//(query) -> args[1]: "pseudonymPrefix" - the names are in the private data collection, so a list can only look at the pseudonym
+	//(query) -> args[2]: "sort", args[3]: "fields" (see query.go)
+
+	borrowing, details := parseOptionalBool("borrowing", args[0])
+	options, optionDetails := parseListOptions(User{}, args[2], args[3])
+	details = append(details, optionDetails...)
+	if len(details) != 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", details...)
 	}
 
 	resultsIterator, err := stub.GetStateByRange("u", "v")
 	if err != nil {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 	defer resultsIterator.Close()
 
-	var buffer bytes.Buffer
-	buffer.WriteString("[\n")
-
+	users := []User{}
 	for resultsIterator.HasNext() {
-		it, _ := resultsIterator.Next()
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
 
-		buffer.WriteString(string(it.Value))
-		buffer.WriteString(",\n")
+		//decoding drops the name old users still have in the public state
+		var user User
+		if err := json.Unmarshal(it.Value, &user); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, "user "+it.Key+" is broken")
+		}
+		if borrowing != nil && *borrowing != (user.BorrowId != 0) {
+			continue
+		}
+		if !strings.HasPrefix(user.Pseudonym, args[1]) {
+			continue
+		}
+		users = append(users, user)
 	}
 
-	buffer.WriteString("]")
-
-	return Success(http.StatusOK, "OK", buffer.Bytes())
+	return listResponse(users, options)
 }
 
 //==============GET ALL BORROWLOGS======SAME AS GETALLCARS============================
 func (cc *CRUD) getAllBorrowLogs(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	if len(args) != 0 {
-		return Error(http.StatusBadRequest, "Parameter Mismatch")
-	}
-
 	resultsIterator, err := stub.GetStateByRange("bor", "bot")
 	if err != nil {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 	defer resultsIterator.Close()
 
-	var buffer bytes.Buffer
-	buffer.WriteString("[\n")
-
+	carBorrows := []CarBorrow{}
 	for resultsIterator.HasNext() {
-		it, _ := resultsIterator.Next()
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
 
-		buffer.WriteString(string(it.Value))
-		buffer.WriteString(",\n")
+		var carBorrow CarBorrow
+		if err := json.Unmarshal(it.Value, &carBorrow); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, "borrow "+it.Key+" is broken")
+		}
+		carBorrows = append(carBorrows, carBorrow)
 	}
 
-	buffer.WriteString("]")
-
-	return Success(http.StatusOK, "OK", buffer.Bytes())
+	carBorrowsAsBytes, _ := json.Marshal(carBorrows)
+	return Success(http.StatusOK, "OK", carBorrowsAsBytes)
 }
 
 //==================GET ALL TRAVELLOGS=======SAME AS GETALLCARS=====================
 func (cc *CRUD) getAllTravelLogs(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	if len(args) != 0 {
-		return Error(http.StatusBadRequest, "Parameter Mismatch")
-	}
-
 	resultsIterator, err := stub.GetStateByRange("t", "u")
 	if err != nil {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 	defer resultsIterator.Close()
 
-	var buffer bytes.Buffer
-	buffer.WriteString("[\n")
-
+	travelLogs := []TravelLog{}
 	for resultsIterator.HasNext() {
-		it, _ := resultsIterator.Next()
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
 
-		buffer.WriteString(string(it.Value))
-		buffer.WriteString(",\n")
+		var travelLog TravelLog
+		if err := json.Unmarshal(it.Value, &travelLog); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, "travelLog "+it.Key+" is broken")
+		}
+		travelLogs = append(travelLogs, travelLog)
 	}
 
-	buffer.WriteString("]")
-
-	return Success(http.StatusOK, "OK", buffer.Bytes())
+	travelLogsAsBytes, _ := json.Marshal(travelLogs)
+	return Success(http.StatusOK, "OK", travelLogsAsBytes)
 }
 
 //=====================TESTING=====================================
 //==================GET ALL KEYS==================================
 func (cc *CRUD) getAllKeys(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	if len(args) != 0 {
-		return Error(http.StatusBadRequest, "Parameter Mismatch")
-	}
-
 	resultsIterator, err := stub.GetStateByRange("", "")
 	if err != nil {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 	defer resultsIterator.Close()
 
-	var buffer bytes.Buffer
-	buffer.WriteString("{ \"ids\": [")
-
+	keys := struct {
+		Ids []string `json:"ids"`
+	}{Ids: []string{}}
 	for resultsIterator.HasNext() {
-		it, _ := resultsIterator.Next()
-		buffer.WriteString("\n")
-		buffer.WriteString("\"")
-		buffer.WriteString(it.Key)
-		buffer.WriteString("\"")
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		keys.Ids = append(keys.Ids, it.Key)
 	}
-	buffer.WriteString("\n")
-	buffer.WriteString("]}")
 
-	return Success(http.StatusOK, "OK", buffer.Bytes())
+	keysAsBytes, _ := json.Marshal(keys)
+	return Success(http.StatusOK, "OK", keysAsBytes)
 }
 
 //==================GET ALL Values==================================
 func (cc *CRUD) getAllValues(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	if len(args) != 0 {
-		return Error(http.StatusBadRequest, "Parameter Mismatch")
-	}
-
 	resultsIterator, err := stub.GetStateByRange("", "")
 	if err != nil {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 	defer resultsIterator.Close()
 
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
-
+	//a value that is no JSON is a JSON string in the list
+	values := []json.RawMessage{}
 	for resultsIterator.HasNext() {
-		it, _ := resultsIterator.Next()
-		buffer.WriteString("\n")
-		buffer.WriteString("\"")
-		buffer.WriteString(string(it.Value))
-		buffer.WriteString("\"")
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		values = append(values, jsonData(it.Value))
 	}
 
-	buffer.WriteString("\n")
-	buffer.WriteString("]}")
-
-	return Success(http.StatusOK, "OK", buffer.Bytes())
+	valuesAsBytes, _ := json.Marshal(values)
+	return Success(http.StatusOK, "OK", valuesAsBytes)
 }
 
 func (cc *CRUD) getAllData(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 
-	if len(args) != 0 {
-		return Error(http.StatusBadRequest, "Parameter Mismatch")
-	}
-
 	resultsIterator, err := stub.GetStateByRange("", "")
 	if err != nil {
-		return Error(http.StatusInternalServerError, err.Error())
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
 	defer resultsIterator.Close()
 
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
-
+	//the same entries as exportLedger, just everything at once
+	entries := []LedgerEntry{}
 	for resultsIterator.HasNext() {
-		it, _ := resultsIterator.Next()
-		buffer.WriteString("\n")
-		buffer.WriteString("\"")
-		buffer.WriteString(it.Key)
-		buffer.WriteString("\" --> ")
-		buffer.WriteString(string(it.Value))
-
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		entries = append(entries, LedgerEntry{Key: it.Key, Type: entityTypeOfKey(it.Key), Value: jsonData(it.Value)})
 	}
-	buffer.WriteString("\n")
-	buffer.WriteString("]")
 
-	return Success(http.StatusOK, "OK", buffer.Bytes())
+	entriesAsBytes, _ := json.Marshal(entries)
+	return Success(http.StatusOK, "OK", entriesAsBytes)
 }
 
-
 //===============================NFC============================
 func (cc *CRUD) nfcBorrow(stub shim.ChaincodeStubInterface, args []string) peer.Response {
-	//here user 3 (daniel = me atm) borrows a car by nfc
-	var userIDToSimulate = 3
-	//in args 0 = id des autos
-	var carIDToBorrow = strconv.Atoi(args[0])
-
-	//create counter and init it with the data in ledger
-	obj, _ := stub.GetState("counterB")
-	counter, _ := strconv.Atoi(string(obj))
-	counter += 1
-
-	//create Starttime
-	time := time.Now()
-	timeString := time.Format("2006-01-02 15:04:05")
-
-
-	//update user
-	ledgerUser, _ := stub.GetState("user" + strconv.Itoa(userIDToSimulate))
-	var user User
-	json.Unmarshal([]byte(ledgerUser), &user)
-
-	if user.Id == 0 {
-		return Error(http.StatusNotFound, "User Not Found - wrong overgiven userId!")
-	}
-	if user.BorrowId != 0 {
-		return Error(http.StatusConflict, "User is already borrowing a car!")
-	}
-
-	user.BorrowId = counter
-	userAsBytes, _ := json.Marshal(user)
-	stub.PutState("user"+strconv.Itoa(user.Id), userAsBytes)
-
-	//update car
-	ledgerCar, _ := stub.GetState("car" + strconv.Itoa(carIDToBorrow))
-	var car Car
-	json.Unmarshal([]byte(ledgerCar), &car)
-
-	if car.Id == 0 {
-		return Error(http.StatusNotFound, "Car Not Found - wrong overgiven carId!")
-	}
-	if car.BorrowId != 0 {
-		return Error(http.StatusConflict, "Car is already borrowed by a Car!")
+	//(path) -> args[0]: "carId"
+	//(body) -> args[1]: {"cardId":1,"nonce":"...","signature":"..."} - the answer of the card to requestNfcChallenge
+	//the user of the card borrows the car
+	carIDToBorrow, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "Cant Atoi args[0] ")
 	}
 
-	//create CarBorrow struct and put it in the ledger
-	carBorrow := CarBorrow{
-		Id: counter, 
-		CarId: carIDToBorrow, 
-		UserId: userIDToSimulate, 
-		StartTime: timeString
+	card, challenge, response, ok := checkNfcResponse(stub, nfcActionBorrow, carIDToBorrow, args[1])
+	if !ok {
+		return response
 	}
-	
-	carBorrowAsBytes, _ := json.Marshal(carBorrow)
-	stub.PutState("borrow"+strconv.Itoa(counter), carBorrowAsBytes)
-	
-	//update cborrow
-	stub.PutState("counterB", []byte(strconv.Itoa(counter)))
-
-	car.BorrowId = counter
-	carAsBytes, _ := json.Marshal(car)
-	stub.PutState("car"+strconv.Itoa(car.Id), carAsBytes)
-
-	//Create Event
-	eventString := "User with id: " + strconv.Itoa(user.Id) + " borrowed successfully car by nfc with id: " + strconv.Itoa(car.Id)
-	stub.SetEvent("Borrow a car by nfc", []byte(eventString))
-	return Success(http.StatusOK, "OK", []byte("Borrow a car by nfc accepted"))
 
+	//the car is picked up where it is
+	response = borrowCar(stub, card.UserId, CheckBorrowCarParameter{CarId: carIDToBorrow}, " by nfc")
+	return setNfcAuditEvent(stub, "Borrow a car by nfc", card, challenge, response)
 }
 
 func (cc *CRUD) nfcReturn(stub shim.ChaincodeStubInterface, args []string) peer.Response {
-	//here user 3 (daniel = me atm) borrows a car by nfc
-	var userIDToSimulate = 3
-	//in args 0 = id des autos
-	var carIDToBorrow = strconv.Atoi(args[0])
-
-	//get User out of ledger and init it here in Code
-	ledgerUser, err := stub.GetState("user" + strconv.Itoa(userIDToSimulate))
-	if err != nil || ledgerUser == nil {
-		return Error(http.StatusBadRequest, "This user doenst exist!")
+	//(path) -> args[0]: "carId"
+	//(body) -> args[1]: {"cardId":1,"nonce":"...","signature":"..."} - the answer of the card to requestNfcChallenge
+	//the user of the card returns the car
+	carIDToReturn, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "Cant Atoi args[0] ")
 	}
 
-	var user User
-	json.Unmarshal([]byte(ledgerUser), &user)
-
-	//check if a car is borrowed
-	if user.BorrowId == 0 {
-		return Error(http.StatusBadRequest, "This user dont have a borrowed car!")
+	card, challenge, response, ok := checkNfcResponse(stub, nfcActionReturn, carIDToReturn, args[1])
+	if !ok {
+		return response
 	}
 
-	//get the borrowInformation to get the borrowed car
-	var carBorrow CarBorrow
-	ledgerBorrow, _ := stub.GetState("borrow" + strconv.Itoa(user.BorrowId))
-	json.Unmarshal([]byte(ledgerBorrow), &carBorrow)
-
-	if carBorrow.CarId == 0 {
-		return Error(http.StatusBadRequest, "Couldnt find car! - shouldnt happen - this car was deleted by admin")
+	ledgerCar, err := stub.GetState("car" + args[0])
+	if err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found")
 	}
-
-	//get the car
 	var car Car
-	ledgerCar, _ := stub.GetState("car" + strconv.Itoa(carBorrow.CarId))
-	json.Unmarshal([]byte(ledgerCar), &car)
+	json.Unmarshal(ledgerCar, &car)
 
-	if car.BorrowId != user.BorrowId {
-		return Error(http.StatusBadRequest, "This Should not happen - check for user.Borrowid != car.Borrowid")
+	//nfc cant classify the trip, so a car in logbook mode has to be returned with userReturnACar
+	logbook, err := getLogbookOfCar(stub, car.Id)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
-
-
-	//create new travelLog and put it in the ledger
-	time := time.Now()
-	timeString := time.Format("2006-01-02 15:04:05")
-	drivenKm := 0
-
-	travelLog := TravelLog{
-		Id:        carBorrow.Id,
-		UserId:    user.Id,
-		CarId:     car.Id,
-		Usage:     "NFC demonstration",
-		StartKm:   car.Km,
-		EndKm:     overgivenParam.NewKm,
-		DrivenKm:  drivenKm,
-		StartTime: carBorrow.StartTime,
-		EndTime:   timeString,
+	if logbook.Enabled {
+		return Error(http.StatusBadRequest, codeLogbookModeRequired, "this car is in logbook mode - return it with userReturnACar")
 	}
 
-	travelLogAsBytes, _ := json.Marshal(travelLog)
-	if err := stub.PutState("travelLog"+strconv.Itoa(travelLog.Id), travelLogAsBytes); err != nil {
-		return Error(http.StatusInternalServerError, "create travelLog failed")
+	//the reader cant ask for the checklist either
+	template, err := readChecklistTemplate(stub, car.Category)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
 	}
-
-	//update user
-	user.BorrowId = 0
-	userAsBytes, _ := json.Marshal(user)
-	if err := stub.PutState("user"+strconv.Itoa(user.Id), userAsBytes); err != nil {
-		return Error(http.StatusInternalServerError, "Update user failed")
+	if hasMandatoryItems(template) {
+		return Error(http.StatusBadRequest, codeChecklistIncomplete, "the checklist of this car has mandatory items - return it with userReturnACar", fieldError("checklist", "is needed for category "+template.Category))
 	}
 
-	//update car
-	car.BorrowId = 0
-	car.Km = overgivenParam.NewKm
-	carAsBytes, _ := json.Marshal(car)
-	if err := stub.PutState("car"+strconv.Itoa(car.Id), carAsBytes); err != nil {
-		return Error(http.StatusInternalServerError, "Update car failed")
+	//the reader does not know the km - the newest reading of the telematics box since the pickup does, if the car has one
+	newKm := car.Km
+	if car.BorrowId != 0 {
+		var carBorrow CarBorrow
+		ledgerBorrow, _ := stub.GetState("borrow" + strconv.Itoa(car.BorrowId))
+		json.Unmarshal(ledgerBorrow, &carBorrow)
+		telemetryKm, found, err := latestTelemetryKm(stub, car.Id, carBorrow.StartTime)
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		if found && telemetryKm > car.Km {
+			newKm = telemetryKm
+		}
 	}
 
-	//create Event when everything went right
-	str := "User: " + strconv.Itoa(user.Id) + " returened his Car: " + strconv.Itoa(car.Id) + " by nfc --> TravelLog: " + strconv.Itoa(travelLog.Id) + " created!"
-	stub.SetEvent("User returned Car by nfc", []byte(str))
-	return Success(http.StatusOK, "OK", []byte("Car returned by nfc"))
-}
\ No newline at end of file
+	//the card opened this car, so the user has to return this one - the reader does not know where the car is
+	overgivenParam := CheckReturnCarParameter{NewKm: newKm, Usage: "NFC demonstration"}
+	response = returnCar(stub, strconv.Itoa(card.UserId), overgivenParam, carIDToReturn, " by nfc")
+	return setNfcAuditEvent(stub, "User returned Car by nfc", card, challenge, response)
+}
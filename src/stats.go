@@ -0,0 +1,229 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//====================================================================================== STATISTICS
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//this one is updated on every return, so nobody has to scan all travelLogs for a statistic
+//ledger keys: "statsCar1", "statsUser1" for all time and "statsCar1_2006-01", "statsUser1_2006-01" for every month
+//the fleet has no key of its own, every return would write it and two returns at once would conflict
+//getFleetStats adds up the statistics of the cars instead
+type UsageStats struct {
+	Month         string `json:"month"`
+	TotalKm       int    `json:"totalKm"`
+	TripCount     int    `json:"tripCount"`
+	TotalDuration int64  `json:"totalDuration"`
+	LastTripId    int    `json:"lastTripId"`
+	LastTripEnd   string `json:"lastTripEnd"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//this one is just the answer of the getXStats functions
+type UsageStatsReport struct {
+	Total  UsageStats   `json:"total"`
+	Months []UsageStats `json:"months"`
+}
+
+//updateStats adds a finished travelLog to the statistics of its car and its user
+func updateStats(stub shim.ChaincodeStubInterface, travelLog TravelLog) error {
+
+	//duration in seconds, a broken time string just counts as 0
+	var duration int64
+	start, errStart := time.Parse(timeFormat, travelLog.StartTime)
+	end, errEnd := time.Parse(timeFormat, travelLog.EndTime)
+	if errStart == nil && errEnd == nil && end.After(start) {
+		duration = int64(end.Sub(start).Seconds())
+	}
+
+	//the trip counts for the month it ended in
+	month := ""
+	if len(travelLog.EndTime) >= 7 {
+		month = travelLog.EndTime[:7]
+	}
+
+	keys := []string{
+		"statsCar" + strconv.Itoa(travelLog.CarId),
+		"statsUser" + strconv.Itoa(travelLog.UserId),
+	}
+
+	for _, key := range keys {
+		if err := addToStats(stub, key, "", travelLog, duration); err != nil {
+			return err
+		}
+		if month == "" {
+			continue
+		}
+		if err := addToStats(stub, key+"_"+month, month, travelLog, duration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addToStats(stub shim.ChaincodeStubInterface, key string, month string, travelLog TravelLog, duration int64) error {
+
+	stats := UsageStats{Month: month}
+	ledgerStats, err := stub.GetState(key)
+	if err != nil {
+		return err
+	}
+	if ledgerStats != nil {
+		if err := json.Unmarshal(ledgerStats, &stats); err != nil {
+			return err
+		}
+	}
+
+	stats.TotalKm += travelLog.DrivenKm
+	stats.TripCount += 1
+	stats.TotalDuration += duration
+	stats.LastTripId = travelLog.Id
+	stats.LastTripEnd = travelLog.EndTime
+
+	statsAsBytes, _ := json.Marshal(stats)
+	return stub.PutState(key, statsAsBytes)
+}
+
+//readStats collects the all time record and every month of one key
+//"statsCar1_" to "statsCar1`" holds only the months of car 1 and not the ones of car 10
+func readStats(stub shim.ChaincodeStubInterface, key string) (UsageStatsReport, error) {
+
+	report := UsageStatsReport{Months: []UsageStats{}}
+
+	ledgerStats, err := stub.GetState(key)
+	if err != nil {
+		return report, err
+	}
+	if ledgerStats != nil {
+		if err := json.Unmarshal(ledgerStats, &report.Total); err != nil {
+			return report, err
+		}
+	}
+
+	resultsIterator, err := stub.GetStateByRange(key+"_", key+"`")
+	if err != nil {
+		return report, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return report, err
+		}
+
+		var stats UsageStats
+		if err := json.Unmarshal(it.Value, &stats); err != nil {
+			return report, err
+		}
+		report.Months = append(report.Months, stats)
+	}
+	return report, nil
+}
+
+//readFleetStats adds up the statistics of every car - "statsCar" to "statsCas" holds all of them
+func readFleetStats(stub shim.ChaincodeStubInterface) (UsageStatsReport, error) {
+
+	report := UsageStatsReport{Months: []UsageStats{}}
+
+	resultsIterator, err := stub.GetStateByRange("statsCar", "statsCas")
+	if err != nil {
+		return report, err
+	}
+	defer resultsIterator.Close()
+
+	months := map[string]*UsageStats{}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return report, err
+		}
+
+		var stats UsageStats
+		if err := json.Unmarshal(it.Value, &stats); err != nil {
+			return report, err
+		}
+		total := &report.Total
+		if stats.Month != "" {
+			if months[stats.Month] == nil {
+				months[stats.Month] = &UsageStats{Month: stats.Month}
+			}
+			total = months[stats.Month]
+		}
+		addStats(total, stats)
+	}
+
+	for _, stats := range months {
+		report.Months = append(report.Months, *stats)
+	}
+	sort.Slice(report.Months, func(i, j int) bool { return report.Months[i].Month < report.Months[j].Month })
+	return report, nil
+}
+
+//addStats adds the statistics of one car to the ones of the fleet - the last trip is the one that ended last
+func addStats(total *UsageStats, stats UsageStats) {
+	total.TotalKm += stats.TotalKm
+	total.TripCount += stats.TripCount
+	total.TotalDuration += stats.TotalDuration
+	if stats.LastTripEnd > total.LastTripEnd {
+		total.LastTripId = stats.LastTripId
+		total.LastTripEnd = stats.LastTripEnd
+	}
+}
+
+func statsResponse(stub shim.ChaincodeStubInterface, key string) peer.Response {
+
+	report, err := readStats(stub, key)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	reportAsBytes, _ := json.Marshal(report)
+	return Success(http.StatusOK, "OK", reportAsBytes)
+}
+
+//===============================GET CAR STATS================================================
+func (cc *CRUD) getCarStats(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+
+	if _, err := strconv.Atoi(args[0]); err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven carId cant be converted to an int")
+	}
+
+	return statsResponse(stub, "statsCar"+args[0])
+}
+
+//===============================GET USER STATS===============================================
+func (cc *CRUD) getUserStats(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+
+	if _, err := strconv.Atoi(args[0]); err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven userId cant be converted to an int")
+	}
+
+	return statsResponse(stub, "statsUser"+args[0])
+}
+
+//===============================GET FLEET STATS==============================================
+func (cc *CRUD) getFleetStats(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+
+	report, err := readFleetStats(stub)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	reportAsBytes, _ := json.Marshal(report)
+	return Success(http.StatusOK, "OK", reportAsBytes)
+}
@@ -0,0 +1,398 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//======================================================================================= TELEMETRY
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//what userReturnACar does if the newKm of the driver and the telemetry differ by more than the tolerance
+const (
+	telemetryMismatchOff    = "off"
+	telemetryMismatchFlag   = "flag"
+	telemetryMismatchReject = "reject"
+)
+
+//a reading may come from a box with a clock a bit ahead, but not from the future
+const telemetryMaxClockSkew = 5 * time.Minute
+
+//a telematics box in a car - ledger key "dev1", the id is the attribute "deviceId" in the certificate of the box
+//LastReadingId is the id of the newest reading of the box, it goes on when the box is moved to another car
+//LastKm and LastReadAt are the newest reading for its car, a box moved to another car starts again
+type TelematicsDevice struct {
+	Id            int    `json:"id"`
+	CarId         int    `json:"carId"`
+	Registered    string `json:"registered"`
+	RegisteredBy  string `json:"registeredBy"`
+	LastReadingId int    `json:"lastReadingId"`
+	LastKm        int    `json:"lastKm"`
+	LastReadAt    string `json:"lastReadAt"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//a box that was built in a car - ledger key "telematics1_3" for box 3 in car 1
+//it stays when the box is moved or deleted, so the readings the box made in the car are still found
+type CarDevice struct {
+	CarId         int    `json:"carId"`
+	DeviceId      int    `json:"deviceId"`
+	Registered    string `json:"registered"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+//one reading of a box - ledger key "odoReading3_12" for reading 12 of box 3, the ids are counted by the box
+//ReadAt is the time of the box, Recorded the one of the transaction
+type OdometerReading struct {
+	Id            int      `json:"id"`
+	CarId         int      `json:"carId"`
+	DeviceId      int      `json:"deviceId"`
+	Km            int      `json:"km"`
+	Location      Location `json:"location"`
+	ReadAt        string   `json:"readAt"`
+	Recorded      string   `json:"recorded"`
+	SchemaVersion int      `json:"schemaVersion"`
+}
+
+//this one is just for internal Operations in func recordTelemetry
+type CheckTelemetryParameter struct {
+	Km       int      `json:"km"`
+	Location Location `json:"location"`
+	ReadAt   string   `json:"readAt"`
+}
+
+//callerDeviceId is the id of the box the caller is - the attribute "deviceId" in his certificate
+func callerDeviceId(stub shim.ChaincodeStubInterface) (int, bool) {
+	value, found, err := cid.GetAttributeValue(stub, "deviceId")
+	if err != nil || !found {
+		return 0, false
+	}
+	id, err := strconv.Atoi(value)
+	return id, err == nil && id > 0
+}
+
+//deviceIdsOfCar are the ids of every box that was built in the car, see CarDevice
+func deviceIdsOfCar(stub shim.ChaincodeStubInterface, carId int) ([]int, error) {
+
+	startKey, endKey := scopedRange("telematics", carId)
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	deviceIds := []int{}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		deviceId, _ := strconv.Atoi(it.Key[len(startKey):])
+		deviceIds = append(deviceIds, deviceId)
+	}
+	return deviceIds, nil
+}
+
+//devicesOfCar are the boxes that are built in the car right now
+func devicesOfCar(stub shim.ChaincodeStubInterface, carId int) ([]TelematicsDevice, error) {
+
+	deviceIds, err := deviceIdsOfCar(stub, carId)
+	if err != nil {
+		return nil, err
+	}
+	devices := []TelematicsDevice{}
+	for _, deviceId := range deviceIds {
+		ledgerDevice, err := stub.GetState("dev" + strconv.Itoa(deviceId))
+		if err != nil {
+			return nil, err
+		}
+		if ledgerDevice == nil {
+			continue
+		}
+		var device TelematicsDevice
+		if err := json.Unmarshal(ledgerDevice, &device); err != nil {
+			return nil, err
+		}
+		//a box moved to another car still has its CarDevice for this one
+		if device.CarId == carId {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+//latestTelemetryKm is the newest km a box of the car read since the overgiven time - found is false if there is none
+//the box sends a reading when the ignition goes off, so the newest one is the km the car was parked with
+func latestTelemetryKm(stub shim.ChaincodeStubInterface, carId int, since string) (int, bool, error) {
+
+	devices, err := devicesOfCar(stub, carId)
+	if err != nil {
+		return 0, false, err
+	}
+
+	km, latest := 0, ""
+	for _, device := range devices {
+		//the times are all in timeFormat, so they compare as strings
+		if device.LastReadAt == "" || device.LastReadAt < since || device.LastReadAt <= latest {
+			continue
+		}
+		km, latest = device.LastKm, device.LastReadAt
+	}
+	return km, latest != "", nil
+}
+
+//checkTelemetryKm compares the newKm of a driver with the telemetry of the car
+//it returns the km of the telemetry (0 if there is none), if they differ too much and why
+func checkTelemetryKm(stub shim.ChaincodeStubInterface, rules OdometerRules, carId int, since string, newKm int) (int, bool, string, error) {
+	if rules.TelemetryMismatch == telemetryMismatchOff {
+		return 0, false, "", nil
+	}
+	telemetryKm, found, err := latestTelemetryKm(stub, carId, since)
+	if err != nil || !found {
+		return 0, false, "", err
+	}
+	difference := newKm - telemetryKm
+	if difference < 0 {
+		difference = -difference
+	}
+	if difference <= rules.TelemetryToleranceKm {
+		return telemetryKm, false, "", nil
+	}
+	return telemetryKm, true, "the overgiven newKm " + strconv.Itoa(newKm) + " differ from the telemetry of the car (" + strconv.Itoa(telemetryKm) + " km) by more than " + strconv.Itoa(rules.TelemetryToleranceKm) + " km", nil
+}
+
+//readingsOfDevice are the readings a box made in a car
+func readingsOfDevice(stub shim.ChaincodeStubInterface, deviceId int, carId int) ([]OdometerReading, error) {
+
+	resultsIterator, err := stub.GetStateByRange(scopedRange("odoReading", deviceId))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	readings := []OdometerReading{}
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var reading OdometerReading
+		if err := json.Unmarshal(it.Value, &reading); err != nil {
+			return nil, errors.New("reading " + it.Key + " is broken")
+		}
+		if reading.CarId == carId {
+			readings = append(readings, reading)
+		}
+	}
+	return readings, nil
+}
+
+//lastReadingIdOfDevice is the id of the newest reading of a box - a deleted box still has its readings
+func lastReadingIdOfDevice(stub shim.ChaincodeStubInterface, deviceId int) (int, error) {
+
+	ledgerDevice, err := stub.GetState("dev" + strconv.Itoa(deviceId))
+	if err != nil {
+		return 0, err
+	}
+	if ledgerDevice != nil {
+		var device TelematicsDevice
+		err := json.Unmarshal(ledgerDevice, &device)
+		return device.LastReadingId, err
+	}
+
+	startKey, endKey := scopedRange("odoReading", deviceId)
+	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	lastReadingId := 0
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		//the key order is odoReading3_1, odoReading3_10, odoReading3_2
+		readingId, _ := strconv.Atoi(it.Key[len(startKey):])
+		if readingId > lastReadingId {
+			lastReadingId = readingId
+		}
+	}
+	return lastReadingId, nil
+}
+
+//=====================================REGISTER DEVICE========================================
+func (cc *CRUD) registerDevice(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "deviceId"
+	//(body) -> args[1]: 1 - the id of the car the box is built in, a registered box is moved to this car
+
+	deviceId, err := strconv.Atoi(args[0])
+	if err != nil || deviceId <= 0 {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "the deviceId has to be greater than 0", fieldError("deviceId", "has to be greater than 0"))
+	}
+	carId, err := strconv.Atoi(args[1])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven carId cant be converted to an int", fieldError("carId", "has to be an integer"))
+	}
+	if ledgerCar, err := stub.GetState("car" + strconv.Itoa(carId)); err != nil || ledgerCar == nil {
+		return Error(http.StatusNotFound, codeCarNotFound, "Car Not Found - wrong overgiven carId!")
+	}
+
+	//the readings of the box keep their keys, so the ids of a box registered again go on
+	lastReadingId, err := lastReadingIdOfDevice(stub, deviceId)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	device := TelematicsDevice{
+		Id:            deviceId,
+		CarId:         carId,
+		Registered:    ledgerNow(stub).Format(timeFormat),
+		RegisteredBy:  callerId(stub),
+		LastReadingId: lastReadingId,
+	}
+	deviceAsBytes, _ := json.Marshal(device)
+	if err := stub.PutState("dev"+strconv.Itoa(deviceId), deviceAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	//the car keeps every box it ever had, the first registration stays
+	carDeviceKey := scopedKey("telematics", carId, deviceId)
+	if obj, err := stub.GetState(carDeviceKey); err != nil || obj == nil {
+		carDeviceAsBytes, _ := json.Marshal(CarDevice{CarId: carId, DeviceId: deviceId, Registered: device.Registered})
+		if err := stub.PutState(carDeviceKey, carDeviceAsBytes); err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+	}
+
+	stub.SetEvent("Device registered", deviceAsBytes)
+	return Success(http.StatusOK, "OK", deviceAsBytes)
+}
+
+//=====================================DELETE DEVICE==========================================
+func (cc *CRUD) deleteDevice(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "deviceId" - the readings of the box stay
+
+	if ledgerDevice, err := stub.GetState("dev" + args[0]); err != nil || ledgerDevice == nil {
+		return Error(http.StatusNotFound, codeDeviceNotFound, "Device Not Found")
+	}
+	if err := stub.DelState("dev" + args[0]); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	stub.SetEvent("Device deleted", []byte("device: "+args[0]))
+	return Success(http.StatusOK, "OK", []byte("Device deleted"))
+}
+
+//=====================================RECORD TELEMETRY=======================================
+func (cc *CRUD) recordTelemetry(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(body) -> args[0]: {"km":1234,"location":{"lat":49.29,"long":8.64},"readAt":"2024-05-02 17:03:00"}
+	//only a registered box can call this - the car is the one the box is registered for
+
+	deviceId, ok := callerDeviceId(stub)
+	if !ok {
+		return Error(http.StatusForbidden, codeDeviceNotFound, "the certificate of the caller has no deviceId")
+	}
+	ledgerDevice, err := stub.GetState("dev" + strconv.Itoa(deviceId))
+	if err != nil || ledgerDevice == nil {
+		return Error(http.StatusForbidden, codeDeviceNotFound, "the box "+strconv.Itoa(deviceId)+" is not registered")
+	}
+	var device TelematicsDevice
+	json.Unmarshal(ledgerDevice, &device)
+
+	var overgivenParam CheckTelemetryParameter
+	if response, ok := decodeBody("reading", args[0], &overgivenParam); !ok {
+		return response
+	}
+	readAt, err := time.Parse(timeFormat, overgivenParam.ReadAt)
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "one parameter is wrong!", fieldError("readAt", "has to be a time like "+timeFormat))
+	}
+	if readAt.After(ledgerNow(stub).Add(telemetryMaxClockSkew)) {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "a reading cant be from the future", fieldError("readAt", "is in the future"))
+	}
+	if overgivenParam.Km <= 0 {
+		return Error(http.StatusBadRequest, codeInvalidKm, "the km of a reading have to be greater than 0", fieldError("km", "has to be greater than 0"))
+	}
+
+	//the readings of a box are in order and an odometer never goes back
+	if device.LastReadAt != "" {
+		if overgivenParam.ReadAt <= device.LastReadAt {
+			return Error(http.StatusConflict, codeInvalidParameter, "the box already sent a reading of "+device.LastReadAt, fieldError("readAt", "has to be after "+device.LastReadAt))
+		}
+		if overgivenParam.Km < device.LastKm {
+			return Error(http.StatusBadRequest, codeInvalidKm, "the km are lower than the last reading of the box", fieldError("km", "has to be at least "+strconv.Itoa(device.LastKm)))
+		}
+	}
+
+	//the id comes from the box and not from a counter of the fleet, so the boxes of two cars never conflict
+	reading := OdometerReading{
+		Id:       device.LastReadingId + 1,
+		CarId:    device.CarId,
+		DeviceId: device.Id,
+		Km:       overgivenParam.Km,
+		Location: overgivenParam.Location,
+		ReadAt:   overgivenParam.ReadAt,
+		Recorded: ledgerNow(stub).Format(timeFormat),
+	}
+	readingAsBytes, _ := json.Marshal(reading)
+	if err := stub.PutState(scopedKey("odoReading", device.Id, reading.Id), readingAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	device.LastReadingId = reading.Id
+	device.LastKm = reading.Km
+	device.LastReadAt = reading.ReadAt
+	deviceAsBytes, _ := json.Marshal(device)
+	if err := stub.PutState("dev"+strconv.Itoa(device.Id), deviceAsBytes); err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	return Success(http.StatusCreated, "Created", readingAsBytes)
+}
+
+//=====================================GET TELEMETRY==========================================
+func (cc *CRUD) getTelemetry(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "carId" - the readings of the car, the oldest first
+	carId, err := strconv.Atoi(args[0])
+	if err != nil {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "overgiven carId cant be converted to an int")
+	}
+
+	//just the readings of the boxes that were built in the car - a box that was moved has readings of other cars
+	deviceIds, err := deviceIdsOfCar(stub, carId)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	readings := []OdometerReading{}
+	for _, deviceId := range deviceIds {
+		deviceReadings, err := readingsOfDevice(stub, deviceId, carId)
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		readings = append(readings, deviceReadings...)
+	}
+
+	//the ids are counted by every box, so the readings of two boxes are in the order the boxes read them
+	sort.Slice(readings, func(i, j int) bool {
+		if readings[i].ReadAt != readings[j].ReadAt {
+			return readings[i].ReadAt < readings[j].ReadAt
+		}
+		return readings[i].DeviceId < readings[j].DeviceId
+	})
+	readingsAsBytes, _ := json.Marshal(readings)
+	return Success(http.StatusOK, "OK", readingsAsBytes)
+}
@@ -0,0 +1,414 @@
+// DISCLAIMER:
+// THIS SAMPLE CODE MAY BE USED SOLELY AS PART OF THE TEST AND EVALUATION OF THE SAP CLOUD PLATFORM
+// BLOCKCHAIN SERVICE (THE “SERVICE”) AND IN ACCORDANCE WITH THE TERMS OF THE AGREEMENT FOR THE SERVICE.
+// THIS SAMPLE CODE PROVIDED “AS IS”, WITHOUT ANY WARRANTY, ESCROW, TRAINING, MAINTENANCE, OR SERVICE
+// OBLIGATIONS WHATSOEVER ON THE PART OF SAP.
+
+//=================================================================================================
+//========================================================================================== TENANT
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//every org of the channel is a tenant with its own fleet - the tenant of a caller is the MSP ID of his certificate
+//the keys of a tenant are "tenant/Org2MSP/car1", tenantStub adds and removes the prefix, so the handlers never see it
+//the home tenant (the org that instantiated the chaincode) has no prefix, so the ledger of the time before tenants stays where it is
+//the keys starting with "tenant" belong to no tenant and no tenant can read or write them
+//the private data of a tenant is in a collection of his own and his events get the same prefix as his keys
+const (
+	tenantNamespace   = "tenant"
+	tenantKeyPrefix   = "tenant/"
+	tenantHomeKey     = "tenantHome"
+	tenantAuditorsKey = "tenantAuditors"
+	tenantsPrefix     = "tenants/"
+)
+
+//an auditor reads the fleets of every tenant with getConsolidatedReport - he needs the attribute role=auditor
+//and has to be of an org Init was given as auditor org, else every tenant could make himself an auditor
+const roleAuditor = "auditor"
+
+//every tenant stub refuses these, the composite keys and rich queries are not tenant aware
+var errTenantUnsupported = errors.New("this query is not supported for tenants")
+
+//tenantStub is the stub of one tenant - every key it reads or writes is one of the tenant
+type tenantStub struct {
+	shim.ChaincodeStubInterface
+	tenant string
+	prefix string
+}
+
+//one tenant of the answer of getConsolidatedReport - Data is what the function answered for the tenant
+type TenantResult struct {
+	Tenant  string          `json:"tenant"`
+	Status  int32           `json:"status"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Details []FieldError    `json:"details,omitempty"`
+}
+
+//callerTenant is the MSP ID of the caller
+func callerTenant(stub shim.ChaincodeStubInterface) (string, error) {
+	tenant, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", err
+	}
+	if tenant == "" || strings.Contains(tenant, "/") {
+		return "", errors.New("the MSP ID " + tenant + " cant be a tenant")
+	}
+	return tenant, nil
+}
+
+//newTenantStub is the stub of a tenant - stub is the one of the transaction
+func newTenantStub(stub shim.ChaincodeStubInterface, tenant string) (*tenantStub, error) {
+	home, err := stub.GetState(tenantHomeKey)
+	if err != nil {
+		return nil, err
+	}
+	if string(home) == tenant {
+		return &tenantStub{ChaincodeStubInterface: stub, tenant: tenant}, nil
+	}
+	return &tenantStub{ChaincodeStubInterface: stub, tenant: tenant, prefix: tenantKeyPrefix + tenant + "/"}, nil
+}
+
+//registerTenant remembers a tenant the first time he writes, so getConsolidatedReport knows him
+func registerTenant(stub shim.ChaincodeStubInterface, tenant string) error {
+	known, err := stub.GetState(tenantsPrefix + tenant)
+	if err != nil || known != nil {
+		return err
+	}
+	return stub.PutState(tenantsPrefix+tenant, []byte(tenant))
+}
+
+//isAuditor is true if the caller has role=auditor and his org is one of the auditor orgs
+func isAuditor(stub shim.ChaincodeStubInterface) bool {
+	if cid.AssertAttributeValue(stub, "role", roleAuditor) != nil {
+		return false
+	}
+	tenant, err := callerTenant(stub)
+	if err != nil {
+		return false
+	}
+	auditors, err := stub.GetState(tenantAuditorsKey)
+	if err != nil {
+		return false
+	}
+	for _, auditor := range splitList(string(auditors)) {
+		if auditor == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+//key is the key of the ledger for a key of the tenant
+func (s *tenantStub) key(key string) string {
+	return s.prefix + key
+}
+
+//checkKey fails for the keys of no tenant - only the home tenant could reach them, his keys have no prefix
+func (s *tenantStub) checkKey(key string) error {
+	if s.prefix == "" && strings.HasPrefix(key, tenantNamespace) {
+		return errors.New("the key " + key + " belongs to no tenant")
+	}
+	return nil
+}
+
+func (s *tenantStub) GetState(key string) ([]byte, error) {
+	if err := s.checkKey(key); err != nil {
+		return nil, err
+	}
+	return s.ChaincodeStubInterface.GetState(s.key(key))
+}
+
+func (s *tenantStub) PutState(key string, value []byte) error {
+	if err := s.checkKey(key); err != nil {
+		return err
+	}
+	return s.ChaincodeStubInterface.PutState(s.key(key), value)
+}
+
+func (s *tenantStub) DelState(key string) error {
+	if err := s.checkKey(key); err != nil {
+		return err
+	}
+	return s.ChaincodeStubInterface.DelState(s.key(key))
+}
+
+func (s *tenantStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	if err := s.checkKey(key); err != nil {
+		return nil, err
+	}
+	return s.ChaincodeStubInterface.GetHistoryForKey(s.key(key))
+}
+
+func (s *tenantStub) SetStateValidationParameter(key string, ep []byte) error {
+	if err := s.checkKey(key); err != nil {
+		return err
+	}
+	return s.ChaincodeStubInterface.SetStateValidationParameter(s.key(key), ep)
+}
+
+func (s *tenantStub) GetStateValidationParameter(key string) ([]byte, error) {
+	if err := s.checkKey(key); err != nil {
+		return nil, err
+	}
+	return s.ChaincodeStubInterface.GetStateValidationParameter(s.key(key))
+}
+
+//collection is the private data collection of the tenant - the home tenant has the one without a suffix
+//every other tenant has his own one, e.g. "collectionUserPII-Org2MSP", with only his org in the policy
+//the prefix of the keys is not needed there, nobody else writes to it
+func (s *tenantStub) collection(collection string) string {
+	if s.prefix == "" {
+		return collection
+	}
+	return collection + "-" + s.tenant
+}
+
+func (s *tenantStub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return s.ChaincodeStubInterface.GetPrivateData(s.collection(collection), key)
+}
+
+func (s *tenantStub) PutPrivateData(collection string, key string, value []byte) error {
+	return s.ChaincodeStubInterface.PutPrivateData(s.collection(collection), key, value)
+}
+
+func (s *tenantStub) DelPrivateData(collection string, key string) error {
+	return s.ChaincodeStubInterface.DelPrivateData(s.collection(collection), key)
+}
+
+func (s *tenantStub) SetPrivateDataValidationParameter(collection string, key string, ep []byte) error {
+	return s.ChaincodeStubInterface.SetPrivateDataValidationParameter(s.collection(collection), key, ep)
+}
+
+func (s *tenantStub) GetPrivateDataValidationParameter(collection string, key string) ([]byte, error) {
+	return s.ChaincodeStubInterface.GetPrivateDataValidationParameter(s.collection(collection), key)
+}
+
+//SetEvent names the event like a key of the tenant, e.g. "tenant/Org2MSP/Car borrowed"
+//so a listener of one tenant can filter his own events - the block itself still goes to every org
+func (s *tenantStub) SetEvent(name string, payload []byte) error {
+	return s.ChaincodeStubInterface.SetEvent(s.key(name), payload)
+}
+
+//rangeKeys are the keys of the ledger for a range of the tenant - "" as endKey is the end of the tenant
+func (s *tenantStub) rangeKeys(startKey string, endKey string) (string, string) {
+	if endKey == "" && s.prefix != "" {
+		//the prefix ends with "/", so everything of the tenant is before the same prefix ending with "0"
+		return s.key(startKey), s.prefix[:len(s.prefix)-1] + "0"
+	}
+	if endKey == "" {
+		return startKey, ""
+	}
+	return s.key(startKey), s.key(endKey)
+}
+
+func (s *tenantStub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	start, end := s.rangeKeys(startKey, endKey)
+	iterator, err := s.ChaincodeStubInterface.GetStateByRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return newTenantIterator(iterator, s.prefix), nil
+}
+
+func (s *tenantStub) GetStateByRangeWithPagination(startKey string, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	start, end := s.rangeKeys(startKey, endKey)
+	if bookmark != "" {
+		bookmark = s.key(bookmark)
+	}
+	iterator, metadata, err := s.ChaincodeStubInterface.GetStateByRangeWithPagination(start, end, pageSize, bookmark)
+	if err != nil {
+		return nil, nil, err
+	}
+	if metadata != nil {
+		metadata.Bookmark = strings.TrimPrefix(metadata.Bookmark, s.prefix)
+	}
+	return newTenantIterator(iterator, s.prefix), metadata, nil
+}
+
+func (s *tenantStub) GetPrivateDataByRange(collection string, startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	return s.ChaincodeStubInterface.GetPrivateDataByRange(s.collection(collection), startKey, endKey)
+}
+
+func (s *tenantStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	return nil, errTenantUnsupported
+}
+
+func (s *tenantStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	return nil, nil, errTenantUnsupported
+}
+
+func (s *tenantStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, errTenantUnsupported
+}
+
+func (s *tenantStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	return nil, nil, errTenantUnsupported
+}
+
+func (s *tenantStub) GetPrivateDataByPartialCompositeKey(collection string, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	return nil, errTenantUnsupported
+}
+
+func (s *tenantStub) GetPrivateDataQueryResult(collection string, query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, errTenantUnsupported
+}
+
+//tenantIterator removes the prefix of the tenant from the keys
+//the home tenant has no prefix, his ranges can hold the keys of the other tenants - these are skipped
+//a skipped key still counts for the page of GetStateByRangeWithPagination, see FetchedRecordsCount
+type tenantIterator struct {
+	shim.StateQueryIteratorInterface
+	prefix string
+	next   *queryresult.KV
+	err    error
+}
+
+func newTenantIterator(iterator shim.StateQueryIteratorInterface, prefix string) *tenantIterator {
+	it := &tenantIterator{StateQueryIteratorInterface: iterator, prefix: prefix}
+	it.advance()
+	return it
+}
+
+//advance reads the next key of the tenant in advance, so HasNext knows if there is one
+func (it *tenantIterator) advance() {
+	it.next, it.err = nil, nil
+	for it.StateQueryIteratorInterface.HasNext() {
+		kv, err := it.StateQueryIteratorInterface.Next()
+		if err != nil {
+			it.err = err
+			return
+		}
+		if it.prefix == "" && strings.HasPrefix(kv.Key, tenantNamespace) {
+			continue
+		}
+		kv.Key = strings.TrimPrefix(kv.Key, it.prefix)
+		it.next = kv
+		return
+	}
+}
+
+func (it *tenantIterator) HasNext() bool {
+	return it.next != nil || it.err != nil
+}
+
+func (it *tenantIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, errors.New("the iterator has no next key")
+	}
+	next, err := it.next, it.err
+	it.advance()
+	return next, err
+}
+
+//transactionStub is the stub of the transaction behind the stub of a tenant
+func transactionStub(stub shim.ChaincodeStubInterface) shim.ChaincodeStubInterface {
+	if tenant, ok := stub.(*tenantStub); ok {
+		return tenant.ChaincodeStubInterface
+	}
+	return stub
+}
+
+//isTenant is true for the home tenant and every tenant that wrote something
+func isTenant(stub shim.ChaincodeStubInterface, tenant string) (bool, error) {
+	names, err := tenants(transactionStub(stub))
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		if name == tenant {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//tenants are the home tenant and every tenant that wrote something, sorted
+func tenants(stub shim.ChaincodeStubInterface) ([]string, error) {
+	names := []string{}
+	home, err := stub.GetState(tenantHomeKey)
+	if err != nil {
+		return nil, err
+	}
+	if home != nil {
+		names = append(names, string(home))
+	}
+
+	resultsIterator, err := stub.GetStateByRange(tenantsPrefix, tenantsPrefix[:len(tenantsPrefix)-1]+"0")
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		it, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if tenant := strings.TrimPrefix(it.Key, tenantsPrefix); tenant != string(home) {
+			names = append(names, tenant)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+//=====================================GET CONSOLIDATED REPORT================================
+func (cc *CRUD) getConsolidatedReport(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//(path) -> args[0]: "function" - a query of the registry, e.g. "getFleetStats"
+	//(body) -> args[1]: ["2024"] - the args of the function, the same for every tenant
+	//the function is called once for every tenant with his stub, a tenant it fails for is in the answer with its error
+
+	spec, found := functionsByName[strings.ToLower(args[0])]
+	//an admin-only query is not run for the auditor either, it could read the whole ledger of a tenant
+	if !found || !spec.Query || spec.Role != roleAnyone || auditorDenied[spec.Name] {
+		return Error(http.StatusBadRequest, codeInvalidParameter, "the function cant be used for a report", fieldError("function", "has to be a query an auditor is allowed to call"))
+	}
+	functionArgs := []string{}
+	if args[1] != "" {
+		if response, ok := decodeBody("args", args[1], &functionArgs); !ok {
+			return response
+		}
+	}
+	functionArgs, response, ok := checkArgs(spec, functionArgs)
+	if !ok {
+		return response
+	}
+
+	//stub is the one of the auditor here, the tenants need the one of the transaction
+	base := transactionStub(stub)
+	names, err := tenants(base)
+	if err != nil {
+		return Error(http.StatusInternalServerError, codeInternal, err.Error())
+	}
+
+	results := []TenantResult{}
+	for _, tenant := range names {
+		tenantStub, err := newTenantStub(base, tenant)
+		if err != nil {
+			return Error(http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		answer := spec.handler(cc, tenantStub, functionArgs)
+		var envelope Envelope
+		json.Unmarshal(answer.Payload, &envelope)
+		results = append(results, TenantResult{Tenant: tenant, Status: answer.Status, Code: envelope.Code, Message: envelope.Message, Data: envelope.Data, Details: envelope.Details})
+	}
+
+	resultsAsBytes, _ := json.Marshal(results)
+	return Success(http.StatusOK, "OK", resultsAsBytes)
+}
+
+//the queries an auditor cant run for every tenant - the personal data stays with the tenant
+var auditorDenied = map[string]bool{"getUserPII": true}